@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	cfg "github.com/zensqlmonitor/influxdb-zabbix/config"
+	helpers "github.com/zensqlmonitor/influxdb-zabbix/helpers"
+	input "github.com/zensqlmonitor/influxdb-zabbix/input"
+	log "github.com/zensqlmonitor/influxdb-zabbix/log"
+	registry "github.com/zensqlmonitor/influxdb-zabbix/reg"
+)
+
+//
+// Backfill command: split [from, to[ in windows processed by a pool of workers per table.
+// Windows done are tracked in registry, so that an interrupted backfill resumes
+// where it stopped without sending again the windows done.
+//
+func backfill(args []string) int {
+
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	cfg.ConfigFlag(fs)
+	dryRunFlag(fs)
+	var tables = fs.String("table", "", "comma separated tables to backfill")
+	var from = fs.String("from", "", "start of the range in yyyy-MM-ddTHH:mm:ss format (included)")
+	var to = fs.String("to", "", "end of the range in yyyy-MM-ddTHH:mm:ss format (excluded)")
+	var workers = fs.Int("workers", 4, "number of windows processed in parallel per table")
+	var hours = fs.Int("hoursperwindow", 24, "size of a window in hours")
+	fs.Parse(args)
+
+	// read configuration file
+	if err := cfg.Parse(&config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cfg.Validate(&config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	initLog()
+	defer log.Close()
+	setLimits(config)
+	if err := initOutput(config); err != nil {
+		log.Error(0, "Backfill: %s", err)
+		return 1
+	}
+	if fileOutput != nil {
+		defer fileOutput.Close()
+	}
+
+	// validate arguments
+	if len(*tables) == 0 {
+		log.Error(0, "Backfill: -table is required")
+		return 2
+	}
+	starttime, endtime, err := parseRange(*from, *to)
+	if err != nil {
+		log.Error(0, "Backfill: %s", err)
+		return 2
+	}
+	if *workers < 1 || *hours < 1 {
+		log.Error(0, "Backfill: -workers and -hoursperwindow must be at least 1")
+		return 2
+	}
+
+	var provider string = (reflect.ValueOf(config.Zabbix).MapKeys())[0].String()
+	var address string = config.Zabbix[provider].Address
+	if _, err := input.NewProvider(provider); err != nil {
+		log.Error(0, "Backfill: %s", err)
+		return 1
+	}
+
+	var params []*Param
+	for _, name := range strings.Split(*tables, ",") {
+		table := findTable(config, strings.TrimSpace(name))
+		if table == nil {
+			log.Error(0, "Backfill: unknown table %q", name)
+			return 2
+		}
+		params = append(params, newParam(provider, address, config, table))
+	}
+
+	// stop dispatching windows on the first signal, abort on the second one
+	dispatchCtx, stopDispatch := context.WithCancel(context.Background())
+	signalChan := make(chan os.Signal, 2)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signalChan
+		log.Info("Received signal %s. finishing in-flight windows", sig)
+		stopDispatch()
+		sig = <-signalChan
+		log.Warn("Received signal %s. aborting in-flight windows", sig)
+		abort()
+	}()
+
+	var failed bool
+	var mu sync.Mutex
+	var tablesWg sync.WaitGroup
+	for _, p := range params {
+		tablesWg.Add(1)
+		go func(p *Param) {
+			defer tablesWg.Done()
+			err := p.backfill(dispatchCtx, starttime, endtime,
+				time.Duration(*hours)*time.Hour, *workers)
+			if err != nil {
+				log.Error(0, "Backfill of %s failed. %s", p.input.tablename, err)
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}(p)
+	}
+	tablesWg.Wait()
+
+	if failed || dispatchCtx.Err() != nil {
+		return 1
+	}
+	return 0
+}
+
+// parseRange parses the -from and -to arguments of a command.
+func parseRange(from string, to string) (time.Time, time.Time, error) {
+	layout := "2006-01-02T15:04:05"
+	starttime, err := time.Parse(layout, from)
+	if err != nil {
+		return starttime, starttime, fmt.Errorf("-from must be formatted as yyyy-MM-ddTHH:mm:ss (%s)", err)
+	}
+	endtime, err := time.Parse(layout, to)
+	if err != nil {
+		return starttime, endtime, fmt.Errorf("-to must be formatted as yyyy-MM-ddTHH:mm:ss (%s)", err)
+	}
+	if !endtime.After(starttime) {
+		return starttime, endtime, fmt.Errorf("-to must be after -from")
+	}
+	return starttime, endtime, nil
+}
+
+// findTable returns the table configured under the given key or name.
+func findTable(config cfg.TOMLConfig, name string) *cfg.Table {
+	for key, table := range config.Tables {
+		if key == name || table.Name == name {
+			return table
+		}
+	}
+	return nil
+}
+
+//
+// Backfill [from, to[ of a table with a pool of workers
+//
+func (p *Param) backfill(ctx context.Context, from time.Time, to time.Time,
+	size time.Duration, workers int) error {
+
+	var currTable string = p.input.tablename
+	var currTableForLog string = helpers.RightPad(currTable, " ", 12-len(currTable))
+
+	done, err := registry.GetBackfill(currentConfig(), currTable, from, to)
+	if err != nil {
+		return err
+	}
+
+	// windows left
+	var windows []registry.Range
+	for start := from; start.Before(to); start = start.Add(size) {
+		end := start.Add(size)
+		if end.After(to) {
+			end = to
+		}
+		if registry.Covered(done, start, end) {
+			continue
+		}
+		windows = append(windows, registry.Range{From: start, To: end})
+	}
+	log.Info("--- Backfill | %s | [%v --> %v[ | %v windows left, %v workers",
+		currTableForLog,
+		from.Format("2006-01-02 15:04:00"),
+		to.Format("2006-01-02 15:04:00"),
+		len(windows),
+		workers)
+
+	jobs := make(chan registry.Range)
+	errs := make(chan error, workers)
+	var poolWg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		poolWg.Add(1)
+		go func() {
+			defer poolWg.Done()
+
+			ext := input.NewExtracter(
+				p.input.provider,
+				p.input.address,
+				p.input.tablename,
+				p.input.queryfile,
+				time.Duration(p.input.querytimeout)*time.Second)
+			if err := ext.Prepare(); err != nil {
+				errs <- err
+				return
+			}
+			defer ext.Close()
+
+			for window := range jobs {
+				if err := p.backfillWindow(&ext, from, to, window); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	// dispatch windows until stopped or a worker fails
+	var firstErr error
+dispatch:
+	for _, window := range windows {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case firstErr = <-errs:
+			break dispatch
+		case jobs <- window:
+		}
+	}
+	close(jobs)
+	poolWg.Wait()
+
+	if firstErr == nil {
+		select {
+		case firstErr = <-errs:
+		default:
+		}
+	}
+	if firstErr == nil && ctx.Err() == nil {
+		log.Info("--- Backfill | %s | Done", currTableForLog)
+	}
+	return firstErr
+}
+
+//
+// Extract and load one window of a backfill, then record it in registry
+//
+func (p *Param) backfillWindow(ext *input.Input, from time.Time, to time.Time,
+	window registry.Range) error {
+
+	var currTable string = p.input.tablename
+	var currTableForLog string = helpers.RightPad(currTable, " ", 12-len(currTable))
+
+	// clocks are in seconds: ]start - 1, end - 1] is [start, end[
+	var startwatch time.Time
+	if err := limit(workCtx, p.input.provider, func() error {
+		startwatch = time.Now()
+		return ext.Extract(workCtx, input.After(window.From.Unix()-1), window.To.Unix()-1)
+	}); err != nil {
+		return err
+	}
+	var rowcount int = len(ext.Result)
+	var extractDuration time.Duration = time.Since(startwatch)
+
+	if rowcount > 0 {
+		if err := p.output.load(workCtx, nil, currTable, ext.Result); err != nil {
+			return err
+		}
+	}
+
+	if !*dryRun {
+		if err := registry.SaveBackfill(currentConfig(), currTable, from, to,
+			window.From, window.To); err != nil {
+			registrySaveFailures.Inc()
+			return err
+		}
+	}
+
+	log.Info("--- Backfill | %s | [%v --> %v[ | %v rows, extract in %s, total %s",
+		currTableForLog,
+		window.From.Format("2006-01-02 15:04:00"),
+		window.To.Format("2006-01-02 15:04:00"),
+		rowcount,
+		extractDuration,
+		time.Since(startwatch))
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	toml "github.com/BurntSushi/toml"
+	cfg "github.com/zensqlmonitor/influxdb-zabbix/config"
+	input "github.com/zensqlmonitor/influxdb-zabbix/input"
+	log "github.com/zensqlmonitor/influxdb-zabbix/log"
+	influx "github.com/zensqlmonitor/influxdb-zabbix/output/influxdb"
+)
+
+// checkTimeout bounds each connectivity test of the check command.
+const checkTimeout = 30 * time.Second
+
+//
+// Check command: validate the configuration, print it with defaults applied
+// and secrets masked, then test the Zabbix database, the SELECT grants and
+// query of each active table and collector, and InfluxDB.
+// Returns 1 on any problem.
+//
+func check(args []string) int {
+
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	cfg.ConfigFlag(fs)
+	fs.Parse(args)
+
+	// read configuration file
+	if err := cfg.Parse(&config); err != nil {
+		fmt.Printf("Configuration: FAILED\n  %s\n", err)
+		return 1
+	}
+	if err := cfg.Validate(&config); err != nil {
+		fmt.Printf("Configuration: FAILED\n  %s\n", err)
+		return 1
+	}
+
+	var buf bytes.Buffer
+	if err := printConfig(&buf, config); err != nil {
+		fmt.Printf("Configuration: FAILED\n  %s\n", err)
+		return 1
+	}
+	fmt.Println("Configuration: OK")
+	fmt.Println()
+	fmt.Println(buf.String())
+
+	failed := false
+	report := func(name string, err error) {
+		if err != nil {
+			failed = true
+			fmt.Printf("%s: FAILED\n  %s\n", name, log.Masked(err.Error()))
+			return
+		}
+		fmt.Printf("%s: OK\n", name)
+	}
+
+	// Zabbix database
+	var provider string
+	for name := range config.Zabbix {
+		provider = name
+	}
+	zabbix := config.Zabbix[provider]
+	timeout := time.Duration(zabbix.QueryTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	err := input.Ping(ctx, provider, zabbix.Address)
+	cancel()
+	report("Zabbix "+provider, err)
+	zabbixUp := err == nil
+
+	// InfluxDB, unless written to files
+	if config.Output.Type == "file" {
+		fmt.Printf("InfluxDB: skipped, output to %s\n", config.Output.FileName)
+	} else {
+		influxdb := config.InfluxDB
+		ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+		report("InfluxDB "+influxdb.Url, influx.Ping(ctx, influxdb.Url, influxdb.Username, influxdb.Password))
+		cancel()
+	}
+
+	if !zabbixUp {
+		fmt.Println("Tables and collectors: skipped, Zabbix database not reachable")
+		return 1
+	}
+
+	// tables: built-in queries check the SELECT grant on each table they read,
+	// then the query is run on an empty window
+	var keys []string
+	for key := range config.Tables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		table := config.Tables[key]
+		name := "Table " + table.Name
+		if !table.Active {
+			fmt.Printf("%s: skipped, not active\n", name)
+			continue
+		}
+		ext := input.NewExtracter(provider, zabbix.Address, table.Name, table.QueryFile, timeout)
+		err := ext.Prepare()
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+			now := time.Now().Unix()
+			err = ext.Extract(ctx, input.After(now), now)
+			cancel()
+		}
+		report(name, err)
+		printSQL(ext.SQL())
+		ext.Close()
+	}
+
+	// collectors: the query is prepared, not run
+	keys = nil
+	for key := range config.Collectors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		collector := config.Collectors[key]
+		name := "Collector " + collector.Name
+		if !collector.Active {
+			fmt.Printf("%s: skipped, not active\n", name)
+			continue
+		}
+		c := input.NewCollector(provider, zabbix.Address, collector.Name, collector.Query, collector.QueryFile,
+			collector.Measurement, collector.Tags, collector.Fields, collector.Timestamp, timeout)
+		report(name, c.Prepare())
+		printSQL(c.SQL())
+		c.Close()
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// printConfig prints the effective configuration, its passwords masked.
+func printConfig(w io.Writer, tomlConfig cfg.TOMLConfig) error {
+	return toml.NewEncoder(w).Encode(cfg.Masked(tomlConfig))
+}
+
+// printSQL prints a query indented under its check line.
+func printSQL(query string) {
+	if len(query) == 0 {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSpace(query), "\n") {
+		fmt.Printf("    %s\n", line)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	toml "github.com/BurntSushi/toml"
+	cfg "github.com/zensqlmonitor/influxdb-zabbix/config"
+)
+
+// Passwords are masked in the printed configuration, whatever they contain.
+func TestPrintConfig(t *testing.T) {
+
+	tests := []struct {
+		provider, address, password string
+	}{
+		{"mysql", "zabbix:p@ss@tcp(localhost:3306)/zabbix", "p@ss"},
+		{"mysql", "zabbix:s3cret@/zabbix", "s3cret"},
+		{"postgres", "postgres://zabbix:p@ss@localhost/zabbix", "p@ss"},
+		{"postgres", "host=localhost user=zabbix password='my s3cret' dbname=zabbix", "my s3cret"},
+	}
+
+	for _, tt := range tests {
+		data := "[influxdb]\ndatabase=\"zabbix\"\npassword=\"influx@pass\"\n" +
+			"[zabbix." + tt.provider + "]\naddress=\"" + tt.address + "\"\n"
+		var tomlConfig cfg.TOMLConfig
+		if _, err := toml.Decode(data, &tomlConfig); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := printConfig(&buf, tomlConfig); err != nil {
+			t.Fatal(err)
+		}
+		out := buf.String()
+		for _, secret := range []string{tt.password, "influx@pass"} {
+			if strings.Contains(out, secret) {
+				t.Errorf("%s: password %q printed\n%s", tt.address, secret, out)
+			}
+		}
+		if !strings.Contains(out, `Database = "zabbix"`) || !strings.Contains(out, cfg.Mask) {
+			t.Errorf("%s: configuration not printed as is\n%s", tt.address, out)
+		}
+	}
+}
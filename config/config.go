@@ -5,11 +5,14 @@ import (
 	"flag"
 	"fmt"
 	"net"
+	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
 	toml "github.com/BurntSushi/toml"
+	schedule "github.com/zensqlmonitor/influxdb-zabbix/schedule"
 )
 
 const (
@@ -20,6 +23,11 @@ const (
 	DefaultLevelConsole     string = "Trace"
 	DefaultLevelFile        string = "Warn"
 	DefaultFormatting       bool   = true
+	DefaultLogFormat        string = "text"
+	DefaultLevelSyslog      string = "Info"
+	DefaultLevelJournald    string = "Info"
+	DefaultSyslogFacility   string = "daemon"
+	DefaultLogTag           string = "influxdb-zabbix"
 	DefaultLogRotate        bool   = true
 	DefaultMaxLines         int    = 1000000
 	DefaultMaxSizeShift     int    = 28
@@ -28,38 +36,74 @@ const (
 
 	DefaultPollingInterval        int = 30
 	DefaultPollingIntervalIfError int = 60
+	DefaultPollingGracePeriod     int = 30
 
 	DefaultInfluxDBUrl       string = "http://localhost:8086"
 	DefaultInfluxDBTimeOut   int    = 0
 	DefaultInfluxDBDatabase  string = "zabbix"
 	DefaultInfluxDBPrecision string = "ms"
 
+	DefaultOutputType     string = "influxdb"
+	DefaultOutputMaxSize  int    = 100 // MB
+	DefaultOutputMaxFiles int    = 7
+
+	DefaultStatsMeasurement string = "influxdb_zabbix_stats"
+
 	DefaultZabbixAddress      string = "host=localhost user=zabbix sslmode=disable database=zabbix"
 	DefaultTableInterval      int    = 15
 	DefaultHoursPerBatch      int    = 320 // 15 days
 	DefaultOutputRowsPerBatch int    = 100000
+	DefaultTargetRows         int    = 200000
+	DefaultMaxLagLevel        string = "Warn"
+
+	DefaultCollectorInterval int = 60
 )
 
 type TOMLConfig struct {
-	InfluxDB influxDB
-	Zabbix   map[string]*zabbix
-	Tables   map[string]*Table
-	Polling  polling
-	Logging  logging
-	Registry registry
+	InfluxDB   influxDB
+	Output     output
+	HTTP       httpServer
+	Stats      stats
+	Zabbix     map[string]*zabbix
+	Tables     map[string]*Table
+	Collectors map[string]*Collector
+	Polling    polling
+	Logging    logging
+	Registry   registry
 }
 
 type influxDB struct {
-	Url       string
-	Database  string
-	Username  string
-	Password  string
-	Precision string
-	TimeOut   int
+	Url          string
+	Database     string
+	Username     string
+	Password     string
+	PasswordFile string `toml:"password_file"`
+	Precision    string
+	TimeOut      int
+}
+
+type output struct {
+	Type     string
+	FileName string
+	MaxSize  int
+	MaxFiles int
+}
+
+type httpServer struct {
+	Listen string
+}
+
+type stats struct {
+	Interval    int
+	Database    string
+	Measurement string
 }
 
 type zabbix struct {
-	Address string
+	Address        string
+	AddressFile    string `toml:"address_file"`
+	MaxExtractions int
+	QueryTimeout   int
 }
 
 type Table struct {
@@ -67,8 +111,29 @@ type Table struct {
 	Active             bool
 	Interval           int
 	Startdate          string
-	Hoursperbatch       int
+	Hoursperbatch      int
 	Outputrowsperbatch int
+	QueryFile          string `toml:"query_file"`
+	Catchup            bool
+	Targetrows         int
+	Overlap            int
+	Offset             int
+	Schedule           string
+	Blackout           string
+	MaxLag             int    `toml:"max_lag"`
+	MaxLagLevel        string `toml:"max_lag_level"`
+	LogLevel           string `toml:"log_level"`
+}
+type Collector struct {
+	Name        string
+	Active      bool
+	Interval    int
+	Query       string
+	QueryFile   string `toml:"query_file"`
+	Measurement string
+	Tags        []string
+	Fields      []string
+	Timestamp   string
 }
 type registry struct {
 	FileName string
@@ -76,29 +141,54 @@ type registry struct {
 type polling struct {
 	Interval        int
 	IntervalIfError int
+	GracePeriod     int
+	MaxExtractions  int
+	Stagger         int
+	LagHook         string `toml:"lag_hook"`
 }
 type logging struct {
-	Modes        string
-	BufferLen    int
-	LevelConsole string
-	LevelFile    string
-	FileName     string
-	Formatting   bool
-	LogRotate    bool
-	MaxLines     int
-	MaxSizeShift int
-	DailyRotate  bool
-	MaxDays      int
+	Modes         string
+	BufferLen     int
+	LevelConsole  string
+	LevelFile     string
+	LevelSyslog   string
+	LevelJournald string
+	FileName      string
+	Formatting    bool
+	Format        string
+	LogRotate     bool
+	MaxLines      int
+	MaxSizeShift  int
+	DailyRotate   bool
+	MaxDays       int
+
+	SyslogNetwork  string
+	SyslogAddress  string
+	SyslogFacility string
+	Tag            string
 }
 
 var fConfig = flag.String("config",
 	"influxdb-zabbix.conf",
 	"the configuration file in TOML format")
 
+// ConfigFlag registers the -config flag on the flag set of a command.
+func ConfigFlag(fs *flag.FlagSet) {
+	fs.StringVar(fConfig, "config", *fConfig, "the configuration file in TOML format")
+}
+
+// Parse reads the configuration file, replaces ${NAME} in string values
+// with environment variables and reads the secret files.
 func Parse(tomlConfig *TOMLConfig) error {
 	if _, err := toml.DecodeFile(*fConfig, &tomlConfig); err != nil {
 		return err
 	}
+	if err := expandEnv(reflect.ValueOf(tomlConfig)); err != nil {
+		return err
+	}
+	if err := tomlConfig.readSecrets(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -133,6 +223,43 @@ func (tomlConfig *TOMLConfig) validate() error {
 	if tomlConfig.Logging.LevelFile == "" {
 		tomlConfig.Logging.LevelFile = DefaultLevelFile
 	}
+	if tomlConfig.Logging.LevelSyslog == "" {
+		tomlConfig.Logging.LevelSyslog = DefaultLevelSyslog
+	}
+	if tomlConfig.Logging.LevelJournald == "" {
+		tomlConfig.Logging.LevelJournald = DefaultLevelJournald
+	}
+	if tomlConfig.Logging.SyslogFacility == "" {
+		tomlConfig.Logging.SyslogFacility = DefaultSyslogFacility
+	}
+	if tomlConfig.Logging.Tag == "" {
+		tomlConfig.Logging.Tag = DefaultLogTag
+	}
+	for _, mode := range strings.Split(tomlConfig.Logging.Modes, ",") {
+		switch strings.TrimSpace(mode) {
+		case "console", "file", "syslog", "journald":
+		default:
+			return fmterr("Validation failed : Logging mode must be console, file, syslog or journald but was '%s'.",
+				strings.TrimSpace(mode))
+		}
+	}
+	switch tomlConfig.Logging.SyslogNetwork {
+	case "", "udp", "tcp":
+	default:
+		return fmterr("Validation failed : Logging syslognetwork must be empty, udp or tcp but was '%s'.",
+			tomlConfig.Logging.SyslogNetwork)
+	}
+	if len(tomlConfig.Logging.SyslogNetwork) > 0 && len(tomlConfig.Logging.SyslogAddress) == 0 {
+		return fmterr("Validation failed : Logging syslogaddress must be set with syslognetwork %s.",
+			tomlConfig.Logging.SyslogNetwork)
+	}
+	if tomlConfig.Logging.Format == "" {
+		tomlConfig.Logging.Format = DefaultLogFormat
+	}
+	if tomlConfig.Logging.Format != "text" && tomlConfig.Logging.Format != "json" {
+		return fmterr("Validation failed : Logging format must be text or json but was '%s'.",
+			tomlConfig.Logging.Format)
+	}
 	if tomlConfig.Logging.MaxLines == 0 {
 		tomlConfig.Logging.MaxLines = DefaultMaxLines
 	}
@@ -148,6 +275,12 @@ func (tomlConfig *TOMLConfig) validate() error {
 	if tomlConfig.Polling.IntervalIfError == 0 {
 		tomlConfig.Polling.IntervalIfError = DefaultPollingIntervalIfError
 	}
+	if tomlConfig.Polling.GracePeriod == 0 {
+		tomlConfig.Polling.GracePeriod = DefaultPollingGracePeriod
+	}
+	if tomlConfig.Polling.MaxExtractions < 0 || tomlConfig.Polling.Stagger < 0 {
+		return fmterr("Validation failed : Polling maxextractions and stagger must be positive.")
+	}
 	if tomlConfig.InfluxDB.Url == "" {
 		tomlConfig.InfluxDB.Url = DefaultInfluxDBUrl
 	}
@@ -161,6 +294,32 @@ func (tomlConfig *TOMLConfig) validate() error {
 		tomlConfig.InfluxDB.TimeOut = DefaultInfluxDBTimeOut
 	}
 
+	// Output
+	if tomlConfig.Output.Type == "" {
+		tomlConfig.Output.Type = DefaultOutputType
+	}
+	if tomlConfig.Output.MaxSize == 0 {
+		tomlConfig.Output.MaxSize = DefaultOutputMaxSize
+	}
+	if tomlConfig.Output.MaxFiles == 0 {
+		tomlConfig.Output.MaxFiles = DefaultOutputMaxFiles
+	}
+	if tomlConfig.Output.Type != "influxdb" && tomlConfig.Output.Type != "file" {
+		return fmterr("Validation failed : Output type must be influxdb or file but was '%s'.",
+			tomlConfig.Output.Type)
+	}
+
+	// Stats
+	if tomlConfig.Stats.Interval < 0 {
+		return fmterr("Validation failed : Stats interval must be positive.")
+	}
+	if tomlConfig.Stats.Database == "" {
+		tomlConfig.Stats.Database = tomlConfig.InfluxDB.Database
+	}
+	if tomlConfig.Stats.Measurement == "" {
+		tomlConfig.Stats.Measurement = DefaultStatsMeasurement
+	}
+
 	// InfluxDB
 	fullUrl := strings.Replace(tomlConfig.InfluxDB.Url, "http://", "", -1)
 
@@ -196,14 +355,14 @@ func (tomlConfig *TOMLConfig) validate() error {
 		if zabbix.Address == "" {
 			return fmterr("Validation failed : You must at least define a Zabbix database address for provider %s.", provider)
 		}
-		if provider == "mysql" {
-			zabbix.Address += "?sql_mode='PIPES_AS_CONCAT'"
+		if zabbix.MaxExtractions < 0 || zabbix.QueryTimeout < 0 {
+			return fmterr("Validation failed : Maxextractions and querytimeout for provider %s must be positive.", provider)
 		}
 	}
 
 	// Zabbix tables
 	tables := tomlConfig.Tables
-	if len(tables) == 0 {
+	if len(tables) == 0 && len(tomlConfig.Collectors) == 0 {
 		return fmterr("Validation failed : You must at least define one table.")
 	}
 	var activeTablesCount = 0
@@ -216,14 +375,16 @@ func (tomlConfig *TOMLConfig) validate() error {
 			tomlConfig.Tables[tableName].Interval = DefaultTableInterval
 		}
 
-		if len(table.Startdate) > 0 {
-			// validate date format
-			layout := "2006-01-02T15:04:05"
-			_, err := time.Parse(
-				layout,
-				table.Startdate)
-			if err != nil {
-				return fmterr("Validation failed : Startdate for table %s is not well formatted.", tableName)
+		if len(table.Startdate) > 0 && table.Startdate != StartdateEarliest {
+			// validate date format, or now, or offset
+			if _, err := ParseStartdate(table.Startdate, time.Now()); err != nil {
+				return fmterr("Validation failed : Startdate for table %s must be yyyy-MM-ddTHH:mm:ss, "+
+					"now, earliest or an offset such as -7d but was '%s'.", tableName, table.Startdate)
+			}
+		}
+		if len(table.QueryFile) > 0 {
+			if _, err := os.Stat(table.QueryFile); err != nil {
+				return fmterr("Validation failed : Query file for table %s cannot be read (%v).", tableName, err)
 			}
 		}
 		if table.Hoursperbatch == 0 {
@@ -232,9 +393,79 @@ func (tomlConfig *TOMLConfig) validate() error {
 		if table.Outputrowsperbatch == 0 {
 			tomlConfig.Tables[tableName].Outputrowsperbatch = DefaultOutputRowsPerBatch
 		}
+		if table.Overlap < 0 {
+			return fmterr("Validation failed : Overlap for table %s must be positive.", tableName)
+		}
+		if table.Offset < 0 {
+			return fmterr("Validation failed : Offset for table %s must be positive.", tableName)
+		}
+		if len(table.Schedule) > 0 {
+			if _, err := schedule.Parse(table.Schedule); err != nil {
+				return fmterr("Validation failed : Schedule for table %s is not valid (%v).", tableName, err)
+			}
+		}
+		if len(table.Blackout) > 0 {
+			if _, err := schedule.ParseBlackout(table.Blackout); err != nil {
+				return fmterr("Validation failed : Blackout for table %s is not valid (%v).", tableName, err)
+			}
+		}
+		if table.MaxLag < 0 {
+			return fmterr("Validation failed : Max lag for table %s must be positive.", tableName)
+		}
+		if table.MaxLagLevel == "" {
+			tomlConfig.Tables[tableName].MaxLagLevel = DefaultMaxLagLevel
+		}
+		if level := tomlConfig.Tables[tableName].MaxLagLevel; level != "Warn" && level != "Error" {
+			return fmterr("Validation failed : Max lag level for table %s must be Warn or Error but was '%s'.",
+				tableName, level)
+		}
+		switch table.LogLevel {
+		case "", "Trace", "Debug", "Info", "Warn", "Error", "Critical":
+		default:
+			return fmterr("Validation failed : Log level for table %s must be one of Trace, Debug, Info, Warn, Error, Critical but was '%s'.",
+				tableName, table.LogLevel)
+		}
+		if table.Targetrows == 0 {
+			tomlConfig.Tables[tableName].Targetrows = DefaultTargetRows
+		}
+	}
+
+	// Custom collectors
+	for collectorName, collector := range tomlConfig.Collectors {
+
+		if collector.Active {
+			activeTablesCount += 1
+		}
+		if len(collector.Name) == 0 {
+			collector.Name = collectorName
+		}
+		if len(collector.Measurement) == 0 {
+			collector.Measurement = collector.Name
+		}
+		if collector.Interval == 0 {
+			collector.Interval = DefaultCollectorInterval
+		}
+		if collector.Interval < 15 {
+			collector.Interval = DefaultTableInterval
+		}
+		if len(collector.Query) == 0 && len(collector.QueryFile) == 0 {
+			return fmterr("Validation failed : Collector %s must define a query or a query_file.", collectorName)
+		}
+		if len(collector.Query) > 0 && len(collector.QueryFile) > 0 {
+			return fmterr("Validation failed : Collector %s cannot define both query and query_file.", collectorName)
+		}
+		if len(collector.QueryFile) > 0 {
+			if _, err := os.Stat(collector.QueryFile); err != nil {
+				return fmterr("Validation failed : Query file for collector %s cannot be read (%v).", collectorName, err)
+			}
+		}
+		if len(collector.Fields) == 0 {
+			return fmterr("Validation failed : Collector %s must define at least one field.", collectorName)
+		}
 	}
+
 	if activeTablesCount == 0 {
-		return fmterr("Validation failed : You must at least define one active table.")
+		return fmterr("Validation failed : You must at least define one active table or collector.")
 	}
 	return nil
 }
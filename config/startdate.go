@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// StartdateLayout is the format of an absolute table start date.
+	StartdateLayout string = "2006-01-02T15:04:05"
+
+	// StartdateNow starts a table at the time its registry entry is created.
+	StartdateNow string = "now"
+
+	// StartdateEarliest starts a table at its oldest row,
+	// resolved when the table is added to the registry.
+	StartdateEarliest string = "earliest"
+)
+
+var startdateUnits = map[byte]time.Duration{
+	's': time.Second,
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+// ParseStartdate returns the time of a table start date:
+// an absolute yyyy-MM-ddTHH:mm:ss in UTC, "now", or an offset before now
+// such as -30m, -12h, -7d or -2w. "earliest" is not handled here.
+func ParseStartdate(startdate string, now time.Time) (time.Time, error) {
+
+	if startdate == StartdateNow {
+		return now, nil
+	}
+	if strings.HasPrefix(startdate, "-") && len(startdate) > 2 {
+		unit, ok := startdateUnits[startdate[len(startdate)-1]]
+		n, err := strconv.Atoi(startdate[1 : len(startdate)-1])
+		if !ok || err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("offset %q must be a number followed by s, m, h, d or w", startdate)
+		}
+		return now.Add(-time.Duration(n) * unit), nil
+	}
+	return time.Parse(StartdateLayout, startdate)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+	"time"
+
+	cfg "github.com/zensqlmonitor/influxdb-zabbix/config"
+	helpers "github.com/zensqlmonitor/influxdb-zabbix/helpers"
+	input "github.com/zensqlmonitor/influxdb-zabbix/input"
+	log "github.com/zensqlmonitor/influxdb-zabbix/log"
+)
+
+//
+// Export command: run the extract/load pipeline once for [from, to[,
+// optionally filtered on hosts and groups. The registry is left untouched.
+//
+func export(args []string) int {
+
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	cfg.ConfigFlag(fs)
+	dryRunFlag(fs)
+	var tables = fs.String("table", "", "comma separated tables to export")
+	var from = fs.String("from", "", "start of the range in yyyy-MM-ddTHH:mm:ss format (included)")
+	var to = fs.String("to", "", "end of the range in yyyy-MM-ddTHH:mm:ss format (excluded)")
+	var hosts = fs.String("host", "", "comma separated host names to export, all when empty")
+	var groups = fs.String("group", "", "comma separated group names to export, all when empty")
+	fs.Parse(args)
+
+	// read configuration file
+	if err := cfg.Parse(&config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cfg.Validate(&config); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	initLog()
+	defer log.Close()
+	setLimits(config)
+	if err := initOutput(config); err != nil {
+		log.Error(0, "Export: %s", err)
+		return 1
+	}
+	if fileOutput != nil {
+		defer fileOutput.Close()
+	}
+
+	// validate arguments
+	if len(*tables) == 0 {
+		log.Error(0, "Export: -table is required")
+		return 2
+	}
+	starttime, endtime, err := parseRange(*from, *to)
+	if err != nil {
+		log.Error(0, "Export: %s", err)
+		return 2
+	}
+	filter := exportFilter{
+		hosts:  splitList(*hosts),
+		groups: splitList(*groups)}
+
+	var provider string = (reflect.ValueOf(config.Zabbix).MapKeys())[0].String()
+	var address string = config.Zabbix[provider].Address
+	if _, err := input.NewProvider(provider); err != nil {
+		log.Error(0, "Export: %s", err)
+		return 1
+	}
+
+	var params []*Param
+	for _, name := range strings.Split(*tables, ",") {
+		table := findTable(config, strings.TrimSpace(name))
+		if table == nil {
+			log.Error(0, "Export: unknown table %q", name)
+			return 2
+		}
+		params = append(params, newParam(provider, address, config, table))
+	}
+
+	// abort the export on signal
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signalChan
+		log.Warn("Received signal %s. aborting export", sig)
+		abort()
+	}()
+
+	for _, p := range params {
+		if err := p.export(starttime, endtime, filter); err != nil {
+			log.Error(0, "Export of %s failed. %s", p.input.tablename, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+//
+// Export [from, to[ of a table in windows of hoursperbatch
+//
+func (p *Param) export(from time.Time, to time.Time, filter exportFilter) error {
+
+	var currTable string = p.input.tablename
+	var currTableForLog string = helpers.RightPad(currTable, " ", 12-len(currTable))
+	var size time.Duration = time.Duration(p.input.hoursperbatch) * time.Hour
+	var total int
+
+	ext := input.NewExtracter(
+		p.input.provider,
+		p.input.address,
+		p.input.tablename,
+		p.input.queryfile,
+		time.Duration(p.input.querytimeout)*time.Second)
+	// built-in queries filter in SQL, user-defined ones on the tags of the lines
+	var userFilter exportFilter
+	if len(p.input.queryfile) == 0 {
+		ext.Hosts = filter.hosts
+		ext.Groups = filter.groups
+	} else {
+		userFilter = filter
+	}
+	if err := ext.Prepare(); err != nil {
+		return err
+	}
+	defer ext.Close()
+
+	for start := from; start.Before(to); start = start.Add(size) {
+		end := start.Add(size)
+		if end.After(to) {
+			end = to
+		}
+
+		// clocks are in seconds: ]start - 1, end - 1] is [start, end[
+		var startwatch time.Time
+		if err := limit(workCtx, p.input.provider, func() error {
+			startwatch = time.Now()
+			return ext.Extract(workCtx, input.After(start.Unix()-1), end.Unix()-1)
+		}); err != nil {
+			return err
+		}
+		result, err := userFilter.apply(ext.Result)
+		if err != nil {
+			return err
+		}
+
+		if len(result) > 0 {
+			if err := p.output.load(workCtx, nil, currTable, result); err != nil {
+				return err
+			}
+		}
+		total += len(result)
+
+		log.Info("--- Export   | %s | [%v --> %v[ | %v rows, total %s",
+			currTableForLog,
+			start.Format("2006-01-02 15:04:00"),
+			end.Format("2006-01-02 15:04:00"),
+			len(result),
+			time.Since(startwatch))
+	}
+
+	log.Info("--- Export   | %s | Done, %v rows", currTableForLog, total)
+	return nil
+}
+
+// exportFilter keeps the lines whose host_name and group_name tags
+// are in the lists. An empty list keeps all values.
+type exportFilter struct {
+	hosts  []string
+	groups []string
+}
+
+// apply returns the lines kept, or an error when a line has no tag to filter on.
+func (f exportFilter) apply(result []string) ([]string, error) {
+
+	if len(f.hosts) == 0 && len(f.groups) == 0 {
+		return result, nil
+	}
+
+	var filtered []string
+	for _, line := range result {
+		tags := lineTags(line)
+		host, hasHost := tags["host_name"]
+		group, hasGroup := tags["group_name"]
+		if len(f.hosts) > 0 && !hasHost {
+			return nil, fmt.Errorf("cannot filter on hosts, line without host_name tag: %s", line)
+		}
+		if len(f.groups) > 0 && !hasGroup {
+			return nil, fmt.Errorf("cannot filter on groups, line without group_name tag: %s", line)
+		}
+		if match(f.hosts, host) && match(f.groups, group) {
+			filtered = append(filtered, line)
+		}
+	}
+	return filtered, nil
+}
+
+func match(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// lineTags returns the unescaped tags of a line protocol line.
+func lineTags(line string) map[string]string {
+
+	tags := make(map[string]string)
+
+	// split measurement and tags on unescaped commas, up to the first unescaped space
+	var parts []string
+	var current []byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' && i+1 < len(line) {
+			current = append(current, line[i+1])
+			i++
+			continue
+		}
+		if c == ' ' {
+			break
+		}
+		if c == ',' {
+			parts = append(parts, string(current))
+			current = nil
+			continue
+		}
+		current = append(current, c)
+	}
+	parts = append(parts, string(current))
+
+	for _, tag := range parts[1:] {
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) == 2 {
+			tags[kv[0]] = kv[1]
+		}
+	}
+	return tags
+}
+
+func splitList(s string) []string {
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			values = append(values, v)
+		}
+	}
+	return values
+}
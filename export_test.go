@@ -0,0 +1,85 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	sqlitetest "github.com/zensqlmonitor/influxdb-zabbix/internal/sqlitetest"
+)
+
+// a second host in its own group, with one row in the window of the sample rows
+var secondHost = []string{
+	`INSERT INTO hosts (hostid, host, name) VALUES (10085, 'db-1', 'db 1')`,
+	`INSERT INTO hstgrp (groupid, name, internal) VALUES (5, 'Databases', 0)`,
+	`INSERT INTO hosts_groups (hostgroupid, hostid, groupid) VALUES (2, 10085, 5)`,
+	`INSERT INTO items (itemid, hostid, name, key_, value_type) VALUES (30000, 10085, 'Load', 'system.cpu.load', 0)`,
+	`INSERT INTO history (itemid, clock, value, ns) VALUES (30000, 1483228845, 1.5, 0)`,
+}
+
+func TestExportFilter(t *testing.T) {
+
+	from := time.Unix(1483228800, 0)
+	to := from.Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		filter exportFilter
+		hosts  []string
+	}{
+		{"all", exportFilter{}, []string{"Zabbix\\ server", "db\\ 1", "Zabbix\\ server", "Zabbix\\ server"}},
+		{"host", exportFilter{hosts: []string{"db 1"}}, []string{"db\\ 1"}},
+		{"hosts", exportFilter{hosts: []string{"db 1", "Zabbix server"}}, []string{"Zabbix\\ server", "db\\ 1", "Zabbix\\ server", "Zabbix\\ server"}},
+		{"group", exportFilter{groups: []string{"Zabbix servers"}}, []string{"Zabbix\\ server", "Zabbix\\ server", "Zabbix\\ server"}},
+		{"host and group", exportFilter{hosts: []string{"db 1"}, groups: []string{"Zabbix servers"}}, nil},
+	}
+
+	db := sqlitetest.NewDB(t, secondHost...)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestParam(t, db, "history", "")
+			if err := p.export(from, to, tt.filter); err != nil {
+				t.Fatal(err)
+			}
+
+			var hosts []string
+			for _, line := range outputLines(t) {
+				hosts = append(hosts, strings.TrimPrefix(strings.Split(line, ",")[1], "host_name="))
+			}
+			if strings.Join(hosts, ",") != strings.Join(tt.hosts, ",") {
+				t.Errorf("hosts %v, want %v", hosts, tt.hosts)
+			}
+		})
+	}
+}
+
+func TestExportFilterQueryFile(t *testing.T) {
+
+	from := time.Unix(1483228800, 0)
+	to := from.Add(time.Hour)
+
+	queryfile := filepath.Join(t.TempDir(), "history.sql")
+	query := `SELECT 'load value=' || value || ' ' || (clock * 1000), clock * 1000, itemid, ns
+FROM history
+WHERE clock > ##STARTDATE## AND clock <= ##ENDDATE##
+ORDER BY clock, ns, itemid`
+	if err := ioutil.WriteFile(queryfile, []byte(query), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db := sqlitetest.NewDB(t)
+	p := newTestParam(t, db, "history", "")
+	p.input.queryfile = queryfile
+
+	if err := p.export(from, to, exportFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.export(from, to, exportFilter{hosts: []string{"Zabbix server"}}); err == nil {
+		t.Error("filter on lines without host_name tag, want an error")
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"math"
@@ -8,7 +10,7 @@ import (
 	"os/signal"
 	"reflect"
 	"runtime"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
@@ -18,33 +20,112 @@ import (
 	helpers "github.com/zensqlmonitor/influxdb-zabbix/helpers"
 	input "github.com/zensqlmonitor/influxdb-zabbix/input"
 	log "github.com/zensqlmonitor/influxdb-zabbix/log"
+	file "github.com/zensqlmonitor/influxdb-zabbix/output/file"
 	influx "github.com/zensqlmonitor/influxdb-zabbix/output/influxdb"
 	registry "github.com/zensqlmonitor/influxdb-zabbix/reg"
+	schedule "github.com/zensqlmonitor/influxdb-zabbix/schedule"
+	status "github.com/zensqlmonitor/influxdb-zabbix/status"
 )
 
-var m runtime.MemStats
-
 var exitChan = make(chan int)
 
 var wg sync.WaitGroup
 
+// stopCtx is cancelled on shutdown: workers finish their in-flight window and stop.
+// workCtx is cancelled when the grace period is over: in-flight windows are aborted.
+var stopCtx, stop = context.WithCancel(context.Background())
+var workCtx, abort = context.WithCancel(context.Background())
+
 type TOMLConfig cfg.TOMLConfig
 
 var config cfg.TOMLConfig
 
+var dryRun = flag.Bool("dry-run", false,
+	"write line protocol to the output file instead of InfluxDB, registry left untouched")
+
+// dryRunFlag registers the -dry-run flag on the flag set of a command.
+func dryRunFlag(fs *flag.FlagSet) {
+	fs.BoolVar(dryRun, "dry-run", *dryRun, flag.Lookup("dry-run").Usage)
+}
+
+// fileOutput is set when line protocol is written to stdout or files
+var fileOutput *file.Writer
+
+// configMu guards config, replaced on reload
+var configMu sync.RWMutex
+
+// gatherer is implemented by table and collector workers
+type gatherer interface {
+	gather(ctx context.Context) error
+	spec() interface{}
+}
+
+type worker struct {
+	param   gatherer
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopped bool
+}
+
+var running = make(map[string]*worker)
+
+var runningMu sync.Mutex
+
+// started is closed once the workers are running
+var started = make(chan struct{})
+
 type DynMap map[string]interface{}
 
 type Param struct {
 	input  Input
 	output Output
+	ext    *input.Input
+
+	// start delay of a table without offset, not compared on reload
+	stagger time.Duration
+
+	// catch-up mode
+	window     time.Duration // size of the last window
+	rate       float64       // rows per hour seen recently, negative if unknown
+	checkpoint time.Time     // end of the last window saved in registry
+	cursor     input.Cursor  // last row read, polling resumes from it in dry-run mode
+
+	// quiet hours
+	schedule *schedule.Schedule // polls on schedule instead of each interval, if set
+	blackout *schedule.Blackout // no poll starts within, if set
+	next     time.Time          // next poll
+
+	state *status.Worker
+}
+
+type CollectorParam struct {
+	collector    cfg.Collector
+	provider     string
+	address      string
+	querytimeout int
+	output       Output
+	col          *input.Collector
+	state        *status.Worker
 }
 
 type Input struct {
 	provider      string
 	address       string
 	tablename     string
+	startdate     string
 	interval      int
 	hoursperbatch int
+	queryfile     string
+	catchup       bool
+	targetrows    int
+	overlap       int
+	offset        int
+	querytimeout  int
+	schedule      string
+	blackout      string
+	maxlag        int
+	maxlaglevel   string
+	loglevel      string
 }
 
 type Output struct {
@@ -54,6 +135,7 @@ type Output struct {
 	password           string
 	precision          string
 	outputrowsperbatch int
+	file               *file.Writer
 }
 
 type InfluxDB struct {
@@ -62,246 +144,618 @@ type InfluxDB struct {
 
 var mapTables = make(registry.MapTable)
 
+// smallest window in catch-up mode
+const minCatchupWindow time.Duration = time.Minute
+
 //
 // Gather data
 //
-func (p *Param) gatherData() error {
+func (p *Param) gatherData(ctx context.Context) error {
 
-	var infoLogs []string
 	var currTable string = p.input.tablename
-	var currTableForLog string = helpers.RightPad(currTable, " ", 12-len(currTable))
 
 	// read registry
+	config := currentConfig()
 	if err := registry.Read(&config, &mapTables); err != nil {
 		fmt.Println(err)
 		return err
 	}
 
-	// set times
-	starttimereg := registry.GetValueFromKey(mapTables, currTable)
-	startimerfc, err := time.Parse("2006-01-02T15:04:05", starttimereg)
+	// set times, from the configuration for a table not yet in registry
+	checkpoint := registry.GetValueFromKey(mapTables, currTable)
+	startimerfc, err := p.startTime(checkpoint)
 	if err != nil {
-		startimerfc, err = time.Parse(time.RFC3339, starttimereg)
-		if err != nil {
-			return err
-		}
+		return err
+	}
+
+	// set cursor, rows up to startdate included are read when not in registry
+	var from input.Cursor = input.After(startimerfc.Unix())
+	if checkpoint.Cursor != nil {
+		from = input.Cursor(*checkpoint.Cursor)
+	}
+	if *dryRun && !p.checkpoint.IsZero() {
+		startimerfc = p.checkpoint
+		from = p.cursor
+	}
+	var window time.Duration = p.nextWindow()
+	var endtimetmp time.Time = startimerfc.Add(window)
+
+	// re-read the trailing overlap for late-arriving data
+	var overlap time.Duration = time.Duration(p.input.overlap) * time.Second
+	var extractstart time.Time = startimerfc.Add(-overlap)
+	var extractfrom input.Cursor = from
+	p.ext.Checkpoint = input.Cursor{}
+	if overlap > 0 {
+		extractfrom = input.After(extractstart.Unix())
+		p.ext.Checkpoint = from
 	}
-	var starttimestr string = strconv.FormatInt(startimerfc.Unix(), 10)
-	var endtimetmp time.Time = startimerfc.Add(time.Hour * time.Duration(p.input.hoursperbatch))
-	var endtimestr string = strconv.FormatInt(endtimetmp.Unix(), 10)
 
 	//
 	// <--  Extract
 	//
-	var tlen int = len(currTable)
-	infoLogs = append(infoLogs,
-		fmt.Sprintf(
-			"----------- | %s | [%v --> %v[",
-			currTableForLog,
-			startimerfc.Format("2006-01-02 15:04:00"),
-			endtimetmp.Format("2006-01-02 15:04:00")))
+	rl := newRunLog(currTable, startimerfc, p.input.loglevel)
+	rl.info("window", log.Fields{"from": startimerfc, "to": endtimetmp},
+		"-----------", "[%v --> %v[",
+		startimerfc.Format("2006-01-02 15:04:00"),
+		endtimetmp.Format("2006-01-02 15:04:00"))
+	if overlap > 0 {
+		rl.info("window", log.Fields{"overlap_from": extractstart},
+			"-----------", "Overlap from %v",
+			extractstart.Format("2006-01-02 15:04:05"))
+	}
 
-	//start watcher
-	startwatch := time.Now()
-	ext := input.NewExtracter(
-		p.input.provider,
-		p.input.address,
-		currTable,
-		starttimestr,
-		endtimestr)
+	//start watcher, once an extraction slot is free
+	var startwatch time.Time
+	ext := p.ext
 
-	if err := ext.Extract(); err != nil {
-		log.Error(1, "Error while executing script: %s", err)
+	p.state.SetState(status.Extracting)
+	if err := limit(ctx, p.input.provider, func() error {
+		startwatch = time.Now()
+		rl.trace("extract", nil, "<-- Extract", "Started")
+		return ext.Extract(ctx, extractfrom, endtimetmp.Unix())
+	}); err != nil {
+		rl.error("extract", err, "Error while executing script: %s", err)
 		return err
 	}
 
 	// count rows
 	var rowcount int = len(ext.Result)
-	infoLogs = append(infoLogs,
-		fmt.Sprintf(
-			"<-- Extract | %s | %v rows in %s",
-			currTableForLog,
-			rowcount,
-			time.Since(startwatch)))
-			
-    // set max clock time
-	var maxclock time.Time = startimerfc
-	if ext.Maxclock.IsZero() == false {
-		maxclock = ext.Maxclock
+	var extractTime time.Duration = time.Since(startwatch)
+	observeExtract(currTable, rowcount, extractTime)
+	rl.info("extract", log.Fields{"rows": rowcount, "duration": extractTime},
+		"<-- Extract", "%v rows in %s",
+		rowcount,
+		extractTime)
+
+	// set next cursor: after the last row read, rows of the overlap do not move it back.
+	// Once the window is over, rows of its end clock not read yet can only arrive late
+	var next input.Cursor = input.Max(from, ext.Cursor)
+	if endtimetmp.Before(time.Now()) {
+		next = input.Max(next, input.Before(endtimetmp.Unix()))
 	}
 
 	// no row
 	if rowcount == 0 {
-		infoLogs = append(infoLogs,
-			fmt.Sprintf(
-				"--> Load    | %s | No data",
-				currTableForLog))
+		rl.info("load", log.Fields{"rows": 0}, "--> Load   ", "No data")
 	} else {
 		//
 		// --> Load
 		//
-		startwatch = time.Now()
-		inlineData := ""
+		p.state.SetState(status.Loading)
+		if err := p.output.load(ctx, rl, currTable, ext.Result); err != nil {
+			return err
+		}
+	}
 
-		if rowcount <= p.output.outputrowsperbatch {
+	// Save in registry
+	p.checkpoint = saveCursor(currTable, next)
+	p.cursor = next
+	p.state.Success(p.checkpoint, rowcount, size(ext.Result))
+	observeCheckpoint(currTable, p.checkpoint)
+	p.observe(rowcount-ext.Reread, window)
+	p.next = p.nextRun(time.Now())
+
+	if p.lagging() && !p.next.After(time.Now()) {
+		rl.info("wait", log.Fields{"lag": time.Since(p.checkpoint), "next_window": p.nextWindow()},
+			"--- Catch-up", "%s behind, next window of %s",
+			time.Since(p.checkpoint).Truncate(time.Second),
+			p.nextWindow())
+	} else if p.schedule != nil || p.blackout != nil {
+		rl.info("wait", log.Fields{"next_run": p.next},
+			"--- Next run", "%v",
+			p.next.Format("2006-01-02 15:04:05"))
+	} else {
+		rl.info("wait", log.Fields{"interval": p.input.interval},
+			"--- Waiting", "%v sec",
+			p.input.interval)
+	}
 
-			inlineData = strings.Join(ext.Result[:], "\n")
+	return nil
+}
 
-			loa := influx.NewLoader(
-				fmt.Sprintf(
-					"%s/write?db=%s&precision=%s",
-					p.output.address,
-					p.output.database,
-					p.output.precision),
-				p.output.username,
-				p.output.password,
-				inlineData)
+//
+// Time polling resumes from: the checkpoint in registry,
+// the startdate of the table when not in registry yet
+//
+func (p *Param) startTime(checkpoint registry.Checkpoint) (time.Time, error) {
+
+	starttimereg := checkpoint.Startdate
+	if len(starttimereg) == 0 {
+		starttimereg = p.input.startdate
+	}
+	startimerfc, err := time.Parse("2006-01-02T15:04:05", starttimereg)
+	if err != nil {
+		startimerfc, err = time.Parse(time.RFC3339, starttimereg)
+	}
+	return startimerfc, err
+}
+
+//
+// Parameters of a worker, used to detect changes on reload
+//
+func (p *Param) spec() interface{} {
+	return []interface{}{p.input, p.output}
+}
+
+func (c *CollectorParam) spec() interface{} {
+	return []interface{}{c.collector, c.provider, c.address, c.querytimeout, c.output}
+}
+
+//
+// Snapshot of the running configuration
+//
+func currentConfig() cfg.TOMLConfig {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return config
+}
+
+//
+// Load data, split in multiple batches if needed
+//
+func (o *Output) load(ctx context.Context, rl *runLog, name string, result []string) error {
+
+	var rowcount int = len(result)
+	var startwatch time.Time = time.Now()
+
+	if rowcount <= o.outputrowsperbatch {
 
-			if err := loa.Load(); err != nil {
-				log.Error(1, "Error while loading data for %s. %s", currTable, err)
+		if err := o.write(ctx, name, 1, 1, result); err != nil {
+			rl.error("load", err, "Error while loading data for %s. %s", name, err)
+			return err
+		}
+
+		var loadTime time.Duration = time.Since(startwatch)
+		rl.info("load", log.Fields{"rows": rowcount, "duration": loadTime},
+			"--> Load   ", "%v rows in %s",
+			rowcount,
+			loadTime)
+
+	} else { // else split result in multiple batches
+
+		var batches float64 = float64(rowcount) / float64(o.outputrowsperbatch)
+		var batchesCeiled float64 = math.Ceil(batches)
+		var batchLoops int = 1
+		var minRange int = 0
+		var maxRange int = 0
+
+		for batches > 0 { // while
+			if batchLoops == 1 {
+				minRange = 0
+			} else {
+				minRange = maxRange
+			}
+
+			maxRange = batchLoops * o.outputrowsperbatch
+			if maxRange >= rowcount {
+				maxRange = rowcount
+			}
+
+			// create slide
+			datapart := []string{}
+			for i := minRange; i < maxRange; i++ {
+				datapart = append(datapart, result[i])
+			}
+
+			startwatch = time.Now()
+			if err := o.write(ctx, name, batchLoops, int(batchesCeiled), datapart); err != nil {
+				rl.error("load", err, "Error while loading data for %s (%v/%v). %s",
+					name, batchLoops, batchesCeiled, err)
 				return err
 			}
+			var loadTime time.Duration = time.Since(startwatch)
 
-			infoLogs = append(infoLogs,
-				fmt.Sprintf(
-					"--> Load    | %s | %v rows in %s",
-					currTableForLog,
-					rowcount,
-					time.Since(startwatch)))
-
-		} else { // else split result in multiple batches
-
-			var batches float64 = float64(rowcount) / float64(p.output.outputrowsperbatch)
-			var batchesCeiled float64 = math.Ceil(batches)
-			var batchLoops int = 1
-			var minRange int = 0
-			var maxRange int = 0
-
-			for batches > 0 { // while
-				if batchLoops == 1 {
-					minRange = 0
-				} else {
-					minRange = maxRange
-				}
+			// log
+			rl.info("load", log.Fields{"rows": len(datapart), "duration": loadTime,
+				"batch": batchLoops, "batches": int(batchesCeiled)},
+				"--> Load   ", "(%v/%v) %v rows in %s",
+				batchLoops,
+				batchesCeiled,
+				len(datapart),
+				loadTime)
 
-				maxRange = batchLoops * p.output.outputrowsperbatch
-				if maxRange >= rowcount {
-					maxRange = rowcount
-				}
+			batchLoops += 1
+			batches -= 1
 
-				// create slide
-				datapart := []string{}
-				for i := minRange; i < maxRange; i++ {
-					datapart = append(datapart, ext.Result[i])
-				}
+		} // end while
+	}
 
-				inlineData = strings.Join(datapart[:], "\n")
-
-				startwatch = time.Now()
-				loa := influx.NewLoader(
-					fmt.Sprintf(
-						"%s/write?db=%s&precision=%s",
-						p.output.address,
-						p.output.database,
-						p.output.precision),
-					p.output.username,
-					p.output.password,
-					inlineData)
-
-				if err := loa.Load(); err != nil {
-					log.Error(1, "Error while loading data for %s. %s", currTable, err)
-					return err
-				}
+	return nil
+}
 
-				// log
-				tableBatchName := fmt.Sprintf("%s (%v/%v)",
-					currTable,
-					batchLoops,
-					batchesCeiled)
+// size returns the bytes of lines sent as line protocol.
+func size(lines []string) int {
+	var n int
+	for _, line := range lines {
+		n += len(line) + 1
+	}
+	return n
+}
 
-				tlen = len(tableBatchName)
+//
+// Write one batch to InfluxDB, or to the output file
+//
+func (o *Output) write(ctx context.Context, name string, batch int, batches int, lines []string) error {
 
-				infoLogs = append(infoLogs,
-					fmt.Sprintf("--> Load    | %s | %v rows in %s",
-						helpers.RightPad(tableBatchName, " ", 13-tlen),
-						len(datapart),
-						time.Since(startwatch)))
+	var output string = "influxdb"
+	if o.file != nil {
+		output = "file"
+	}
+	var startwatch time.Time = time.Now()
+	err := o.send(ctx, name, batch, batches, lines)
+	observeLoad(name, output, len(lines), time.Since(startwatch), err)
+	return err
+}
 
-				batchLoops += 1
-				batches -= 1
+func (o *Output) send(ctx context.Context, name string, batch int, batches int, lines []string) error {
 
-			} // end while
-		}
+	if o.file != nil {
+		return o.file.Write(name, batch, batches, lines)
 	}
 
-	// Save in registry
-	saveMaxTime(currTable, startimerfc, maxclock, p.input.hoursperbatch)
+	loa := influx.NewLoader(
+		fmt.Sprintf(
+			"%s/write?db=%s&precision=%s",
+			o.address,
+			o.database,
+			o.precision),
+		o.username,
+		o.password,
+		strings.Join(lines, "\n"))
+
+	return loa.Load(ctx)
+}
+
+//
+// Start the HTTP status listener, if configured
+//
+func initStatus(config cfg.TOMLConfig) error {
+
+	if len(config.HTTP.Listen) == 0 {
+		return nil
+	}
+	if err := status.Start(config.HTTP.Listen, ready); err != nil {
+		return err
+	}
+	log.Info("--- Status listening on %s", config.HTTP.Listen)
+	return nil
+}
 
-	tlen = len(currTable)
-	infoLogs = append(infoLogs,
-		fmt.Sprintf("--- Waiting | %s | %v sec ",
-			currTableForLog,
-			p.input.interval))
+//
+// Readiness: Zabbix database and InfluxDB reachable
+//
+func ready(ctx context.Context) error {
 
-	if config.Logging.LevelFile == "Trace" || config.Logging.LevelConsole == "Trace" {
-		runtime.ReadMemStats(&m)
-		log.Trace(fmt.Sprintf("--- Memory usage: Alloc = %s | TotalAlloc = %s | Sys = %s | NumGC = %v", 
-			helpers.IBytes(m.Alloc / 1024), 
-			helpers.IBytes(m.TotalAlloc / 1024), 
-			helpers.IBytes(m.Sys / 1024), 
-			m.NumGC))
+	config := currentConfig()
+	var provider string = (reflect.ValueOf(config.Zabbix).MapKeys())[0].String()
+	if err := input.Ping(ctx, provider, config.Zabbix[provider].Address); err != nil {
+		return fmt.Errorf("Zabbix database not reachable: %v", err)
+	}
+	if fileOutput == nil {
+		influxdb := config.InfluxDB
+		if err := influx.Ping(ctx, influxdb.Url, influxdb.Username, influxdb.Password); err != nil {
+			return fmt.Errorf("InfluxDB not reachable: %v", err)
+		}
 	}
+	return nil
+}
 
-				
-	// print all log messages
-	print(infoLogs)
+//
+// Set the output file in dry-run mode or for an output of type file
+//
+func initOutput(config cfg.TOMLConfig) error {
 
+	if !*dryRun && config.Output.Type != "file" {
+		return nil
+	}
+	writer, err := file.NewWriter(
+		config.Output.FileName,
+		int64(config.Output.MaxSize)*helpers.MiByte,
+		config.Output.MaxFiles)
+	if err != nil {
+		return err
+	}
+	fileOutput = writer
+	if *dryRun {
+		log.Info("--- Dry-run: writing to %s, registry left untouched", outputName(config))
+	}
 	return nil
 }
 
+func outputName(config cfg.TOMLConfig) string {
+	if len(config.Output.FileName) == 0 || config.Output.FileName == "-" {
+		return "stdout"
+	}
+	return config.Output.FileName
+}
+
 //
-// Print all messages
+// Save cursor, with its clock as startdate
 //
-func print(infoLogs []string) {
-	for i := 0; i < len(infoLogs); i++ {
-		log.Info(infoLogs[i])
+func saveCursor(tablename string, cursor input.Cursor) time.Time {
+
+	var timetosave time.Time = time.Unix(cursor.Clock, 0)
+
+	if *dryRun {
+		return timetosave
 	}
+	regCursor := registry.Cursor(cursor)
+	checkpoint := registry.Checkpoint{
+		Startdate: timetosave.Format(time.RFC3339),
+		Cursor:    &regCursor}
+	registry.SetValueByKey(&mapTables, tablename, checkpoint)
+	if err := registry.Save(currentConfig(),
+		tablename,
+		checkpoint); err != nil {
+		registrySaveFailures.Inc()
+		log.Error(1, "Error while saving registry for %s. %s", tablename, err)
+	}
+	return timetosave
 }
 
 //
-// Save max time 
+// Catch-up mode: size of the next window
+//   from the rows per hour seen recently and the target rows per extract,
+//   at most hoursperbatch and twice the last window
 //
-func saveMaxTime(tablename string, starttime time.Time, maxtime time.Time, duration int) {
+func (p *Param) nextWindow() time.Duration {
+
+	var maxWindow time.Duration = time.Duration(p.input.hoursperbatch) * time.Hour
+	if !p.input.catchup {
+		return maxWindow
+	}
+
+	// unknown density, start small
+	if p.window == 0 {
+		p.rate = -1
+		return minDuration(time.Hour, maxWindow)
+	}
 
-	var timetosave time.Time
+	var window time.Duration = 2 * p.window
+	if p.rate > 0 {
+		var hours float64 = float64(p.input.targetrows) / p.rate
+		window = minDuration(window, time.Duration(hours*float64(time.Hour)))
+	}
+	if window < minCatchupWindow {
+		window = minCatchupWindow
+	}
+	return minDuration(window, maxWindow)
+}
 
-	// if maxtime is greater than now, keep the maxclock returned 
-	if (starttime.Add(time.Hour * time.Duration(duration))).After(time.Now()) {
-		timetosave = maxtime
+// observe records the density of the last window
+func (p *Param) observe(rowcount int, window time.Duration) {
+	p.window = window
+	var rate float64 = float64(rowcount) / window.Hours()
+	if p.rate < 0 {
+		p.rate = rate
 	} else {
-		timetosave = starttime.Add(time.Hour * time.Duration(duration))
+		p.rate = (p.rate + rate) / 2
 	}
+}
 
-	registry.Save(config,
-		tablename,
-		timetosave.Format(time.RFC3339))
+// lagging reports whether the checkpoint is behind now by more than the interval
+func (p *Param) lagging() bool {
+	return p.input.catchup &&
+		time.Since(p.checkpoint) > time.Duration(p.input.interval)*time.Second
+}
+
+func minDuration(a time.Duration, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
 }
 
 //
 // Gather data loop
 //
-func (p *Param) gather() error {
+func (p *Param) gather(ctx context.Context) error {
+
+	p.state = status.Register("table", p.input.tablename)
+	p.state.SetMaxLag(time.Duration(p.input.maxlag)*time.Second, p.input.maxlaglevel)
+
+	// lag is known before the first window, which may hang or fail
+	if start, err := p.startTime(registry.GetValueFromKey(mapTables, p.input.tablename)); err == nil {
+		p.state.SetCheckpoint(start)
+		observeCheckpoint(p.input.tablename, start)
+	}
+
+	// prepare the table query once
+	ext := input.NewExtracter(
+		p.input.provider,
+		p.input.address,
+		p.input.tablename,
+		p.input.queryfile,
+		time.Duration(p.input.querytimeout)*time.Second)
+	if err := ext.Prepare(); err != nil {
+		log.Error(1, "Error while preparing query for %s: %s", p.input.tablename, err)
+		p.state.Failure(err)
+		return err
+	}
+	defer ext.Close()
+	p.ext = &ext
+
+	// first poll after the staggered start offset, on schedule
+	p.next = p.runAt(time.Now().Add(time.Duration(p.input.offset)*time.Second + p.stagger))
+	p.state.SetNextRun(p.next)
+	p.state.SetState(status.Waiting)
+	if p.schedule != nil || p.blackout != nil {
+		log.Info("--- Next run | %s | %v",
+			helpers.RightPad(p.input.tablename, " ", 12-len(p.input.tablename)),
+			p.next.Format("2006-01-02 15:04:05"))
+	}
+
 	for {
-		err := p.gatherData()
+		select {
+		case <-ctx.Done():
+			p.state.SetState(status.Stopped)
+			return nil
+		case <-time.After(time.Until(p.next)):
+		}
+		if ctx.Err() != nil {
+			p.state.SetState(status.Stopped)
+			return nil
+		}
+
+		err := p.gatherData(workCtx)
 		if err != nil {
+			p.state.Failure(err)
 			return err
 		}
+		p.state.SetNextRun(p.next)
+		p.state.SetState(status.Waiting)
+	}
+}
 
-		time.Sleep(time.Duration(p.input.interval) * time.Second)
+//
+// Time of the next poll:
+//   back-to-back while lagging in catch-up mode, within the scheduled minutes,
+//   else on schedule or after the interval, outside the blackout
+//
+func (p *Param) nextRun(now time.Time) time.Time {
+
+	var next time.Time = now.Add(time.Duration(p.input.interval) * time.Second)
+	if p.schedule != nil {
+		next = p.schedule.Next(now)
 	}
+	if p.lagging() && (p.schedule == nil || p.schedule.Matches(now)) {
+		next = now
+	}
+	return p.runAt(next)
+}
+
+// runAt returns the first time from t included on schedule and outside the blackout.
+// It gives up after a few rounds if the schedule only matches within the blackout.
+func (p *Param) runAt(t time.Time) time.Time {
+	for i := 0; i < 100; i++ {
+		switch {
+		case p.schedule != nil && !p.schedule.Matches(t):
+			t = p.schedule.Next(t)
+		case p.blackout != nil && p.blackout.Contains(t):
+			t = p.blackout.After(t)
+		default:
+			return t
+		}
+	}
+	return t
+}
+
+//
+// Gather custom collector data
+//
+func (c *CollectorParam) gatherData(ctx context.Context) error {
+
+	var currName string = c.collector.Name
+	rl := newRunLog(currName, time.Time{}, "")
+
+	//
+	// <--  Extract
+	//
+	var startwatch time.Time
+	col := c.col
+
+	c.state.SetState(status.Extracting)
+	if err := limit(ctx, c.provider, func() error {
+		startwatch = time.Now()
+		rl.trace("extract", nil, "<-- Collect", "Started")
+		return col.Collect(ctx)
+	}); err != nil {
+		rl.error("extract", err, "Error while executing collector %s: %s", currName, err)
+		return err
+	}
+
+	var rowcount int = len(col.Result)
+	var collectTime time.Duration = time.Since(startwatch)
+	observeExtract(currName, rowcount, collectTime)
+	rl.info("extract", log.Fields{"rows": rowcount, "duration": collectTime},
+		"<-- Collect", "%v rows in %s",
+		rowcount,
+		collectTime)
+
+	//
+	// --> Load
+	//
+	if rowcount == 0 {
+		rl.info("load", log.Fields{"rows": 0}, "--> Load   ", "No data")
+	} else {
+		c.state.SetState(status.Loading)
+		if err := c.output.load(ctx, rl, currName, col.Result); err != nil {
+			return err
+		}
+	}
+	c.state.Success(time.Time{}, rowcount, size(col.Result))
+
+	rl.info("wait", log.Fields{"interval": c.collector.Interval},
+		"--- Waiting", "%v sec",
+		c.collector.Interval)
+
 	return nil
 }
 
+//
+// Gather custom collector data loop
+//
+func (c *CollectorParam) gather(ctx context.Context) error {
+
+	col := input.NewCollector(
+		c.provider,
+		c.address,
+		c.collector.Name,
+		c.collector.Query,
+		c.collector.QueryFile,
+		c.collector.Measurement,
+		c.collector.Tags,
+		c.collector.Fields,
+		c.collector.Timestamp,
+		time.Duration(c.querytimeout)*time.Second)
+	c.state = status.Register("collector", c.collector.Name)
+	if err := col.Prepare(); err != nil {
+		log.Error(1, "Error while preparing query for collector %s: %s", c.collector.Name, err)
+		c.state.Failure(err)
+		return err
+	}
+	defer col.Close()
+	c.col = &col
+
+	for {
+		err := c.gatherData(workCtx)
+		if err != nil {
+			c.state.Failure(err)
+			return err
+		}
+
+		var interval time.Duration = time.Duration(c.collector.Interval) * time.Second
+		c.state.SetNextRun(time.Now().Add(interval))
+		c.state.SetState(status.Waiting)
+		select {
+		case <-ctx.Done():
+			c.state.SetState(status.Stopped)
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
 //
 // Init
 //
@@ -310,33 +764,109 @@ func init() {
 }
 
 //
-//  Read TOML configuration
+//  Read TOML configuration, exit on error
 //
 func readConfig() {
 
-	// command-line flag parsing
-	flag.Parse()
-
 	// read configuration file
 	if err := cfg.Parse(&config); err != nil {
-		fmt.Println(err)
-		return
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 	// validate configuration file
 	if err := cfg.Validate(&config); err != nil {
-		fmt.Println(err)
-		return
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
 
 //
-// Read registry file
+// Read registry file, if any table is configured, and add the tables new to it
+// with their startdates resolved. Nothing is written in dry-run mode.
 //
-func readRegistry() {
-	if err := registry.Read(&config, &mapTables); err != nil {
-		log.Error(0, err.Error())
-		return
+func initRegistry(tomlConfig cfg.TOMLConfig) error {
+	if len(tomlConfig.Tables) == 0 {
+		return nil
+	}
+	if err := registry.Read(&tomlConfig, &mapTables); err != nil {
+		return err
+	}
+	startdates, err := resolveStartdates(tomlConfig)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		// polling starts from the resolved startdates, not saved
+		for tableName, startdate := range startdates {
+			registry.SetValueByKey(&mapTables, tableName, registry.Checkpoint{Startdate: startdate})
+		}
+		return nil
+	}
+	if err := registry.Create(&tomlConfig, startdates); err != nil {
+		return err
 	}
+	return registry.Read(&tomlConfig, &mapTables)
+}
+
+//
+// Absolute startdates of the tables not yet in registry.
+// Symbolic startdates of inactive tables are resolved once the table is activated.
+// Rows up to the startdate included are not read, so earliest is
+// the second before the oldest row, or now for an empty table.
+//
+func resolveStartdates(tomlConfig cfg.TOMLConfig) (map[string]string, error) {
+
+	startdates := make(map[string]string)
+	now := time.Now().UTC()
+	for _, table := range tomlConfig.Tables {
+		if len(table.Startdate) == 0 || len(registry.GetValueFromKey(mapTables, table.Name).Startdate) > 0 {
+			continue
+		}
+		if _, err := time.Parse(cfg.StartdateLayout, table.Startdate); err == nil {
+			startdates[table.Name] = table.Startdate
+			continue
+		}
+		if !table.Active {
+			continue
+		}
+
+		var startdate time.Time
+		var err error
+		if table.Startdate == cfg.StartdateEarliest {
+			startdate, err = earliest(tomlConfig, table.Name, now)
+		} else {
+			startdate, err = cfg.ParseStartdate(table.Startdate, now)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Startdate of table %s cannot be resolved. %v", table.Name, err)
+		}
+		startdates[table.Name] = startdate.Format(cfg.StartdateLayout)
+		log.Trace("------ Startdate %s of table %s resolved to %s",
+			table.Startdate, table.Name, startdates[table.Name])
+	}
+	return startdates, nil
+}
+
+//
+// The second before the oldest row of a table, now when it is empty
+//
+func earliest(tomlConfig cfg.TOMLConfig, tablename string, now time.Time) (time.Time, error) {
+
+	// one provider, validated with the configuration
+	for provider, zabbix := range tomlConfig.Zabbix {
+		ctx := context.Background()
+		if zabbix.QueryTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(zabbix.QueryTimeout)*time.Second)
+			defer cancel()
+		}
+		t, err := input.Earliest(ctx, provider, zabbix.Address, tablename)
+		if err != nil || t.IsZero() {
+			return now, err
+		}
+		return t.Add(-time.Second).UTC(), nil
+	}
+	return now, errors.New("no Zabbix provider")
 }
 
 //
@@ -356,78 +886,194 @@ func listenToSystemSignals() {
 	signal.Notify(signalChan, os.Interrupt)
 	signal.Notify(signalChan, os.Kill)
 	signal.Notify(signalChan, syscall.SIGTERM)
+	signal.Notify(signalChan, syscall.SIGHUP)
 
-	select {
-	case sig := <-signalChan:
-		log.Info("Received signal %s. shutting down", sig)
-	case code = <-exitChan:
-		switch code {
-		case 0:
-			log.Info("Shutting down")
-		default:
-			log.Warn("Shutting down")
+	for {
+		select {
+		case sig := <-signalChan:
+			if sig == syscall.SIGHUP {
+				select {
+				case <-started:
+					reloadConfig()
+				default:
+					log.Warn("Received signal %s before polling started, ignored", sig)
+				}
+				continue
+			}
+			log.Info("Received signal %s. shutting down", sig)
+		case code = <-exitChan:
+			switch code {
+			case 0:
+				log.Info("Shutting down")
+			default:
+				log.Warn("Shutting down")
+			}
 		}
+		shutdown(code)
 	}
-	log.Close()
-	os.Exit(code)
 }
 
 //
-// Main
+// Shutdown: let workers finish their in-flight window,
+// abort them after the grace period and flush the registry
 //
-func main() {
+func shutdown(code int) {
+	stop()
 
-	log.Info("***** Starting influxdb-zabbix *****")
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
 
-	// listen to System Signals
-	go listenToSystemSignals()
+	config := currentConfig()
+	var grace time.Duration = time.Duration(config.Polling.GracePeriod) * time.Second
+	select {
+	case <-done:
+	case <-time.After(grace):
+		log.Warn("Grace period of %v elapsed, aborting in-flight windows", grace)
+		abort()
+		<-done
+	}
 
-	readConfig()
-	readRegistry()
-	initLog()
+	if config.Stats.Interval > 0 {
+		if err := flushStats(config); err != nil {
+			log.Error(0, "Error while writing stats. %s", err)
+		}
+	}
+	if fileOutput != nil {
+		fileOutput.Close()
+	}
+	if len(mapTables) > 0 && !*dryRun {
+		if err := registry.Flush(config, mapTables); err != nil {
+			registrySaveFailures.Inc()
+			log.Error(0, "Error while flushing registry. %s", err)
+			code = 1
+		}
+	}
+	log.Close()
+	os.Exit(code)
+}
 
-	// set of active tables
-	log.Trace("--- Active tables:")
-	var tables = []*cfg.Table{}
-	for _, table := range config.Tables {
-		if table.Active {
-			var tlen int = len(table.Name)
-			var durationh string
-			var duration time.Duration = time.Duration(table.Hoursperbatch) * time.Hour
-			if (duration.Hours() >= 24) {
-				durationh = fmt.Sprintf("%v days per batch", duration.Hours()/24)
-			} else {
-				durationh = fmt.Sprintf("%v hours per batch", duration.Hours())
-			}
+//
+// Parameters of a table worker
+//
+func newParam(provider string, address string, config cfg.TOMLConfig, table *cfg.Table) *Param {
 
-			log.Trace(
-				fmt.Sprintf(
-					"----------- | %s | Each %v sec | %s | Output by %v",
-					helpers.RightPad(table.Name, " ", 12-tlen),
-					table.Interval,
-					durationh,
-					table.Outputrowsperbatch))
+	influxdb := config.InfluxDB
 
-			tables = append(tables, table)
-		}
+	input := Input{
+		provider,
+		address,
+		table.Name,
+		table.Startdate,
+		table.Interval,
+		table.Hoursperbatch,
+		table.QueryFile,
+		table.Catchup,
+		table.Targetrows,
+		table.Overlap,
+		table.Offset,
+		config.Zabbix[provider].QueryTimeout,
+		table.Schedule,
+		table.Blackout,
+		table.MaxLag,
+		table.MaxLagLevel,
+		table.LogLevel}
+
+	output := Output{
+		influxdb.Url,
+		influxdb.Database,
+		influxdb.Username,
+		influxdb.Password,
+		influxdb.Precision,
+		table.Outputrowsperbatch,
+		fileOutput}
+
+	p := &Param{input: input, output: output}
+
+	// validated with the configuration
+	if len(table.Schedule) > 0 {
+		p.schedule, _ = schedule.Parse(table.Schedule)
+	}
+	if len(table.Blackout) > 0 {
+		p.blackout, _ = schedule.ParseBlackout(table.Blackout)
 	}
+	return p
+}
 
-	log.Info("--- Start polling")
+//
+// Set of workers to run from the active tables and collectors
+//
+func newWorkers(config cfg.TOMLConfig) (map[string]gatherer, error) {
+
+	var workers = make(map[string]gatherer)
 
 	var provider string = (reflect.ValueOf(config.Zabbix).MapKeys())[0].String()
 	var address string = config.Zabbix[provider].Address
-	log.Trace(fmt.Sprintf("--- Provider: %s", provider))
+	log.Trace("--- Provider: %s", provider)
+	if _, err := input.NewProvider(provider); err != nil {
+		return nil, err
+	}
 
 	influxdb := config.InfluxDB
-	
-	for _, table := range tables {
 
-		input := Input{
-			provider,
-			address,
-			table.Name,
+	// set of active tables
+	log.Trace("--- Active tables:")
+	for key, table := range config.Tables {
+		if !table.Active {
+			continue
+		}
+		var tlen int = len(table.Name)
+		var durationh string
+		var duration time.Duration = time.Duration(table.Hoursperbatch) * time.Hour
+		if duration.Hours() >= 24 {
+			durationh = fmt.Sprintf("%v days per batch", duration.Hours()/24)
+		} else {
+			durationh = fmt.Sprintf("%v hours per batch", duration.Hours())
+		}
+		if table.Catchup {
+			durationh = fmt.Sprintf("Catch-up by %v rows, up to %s", table.Targetrows, durationh)
+		}
+		if table.Overlap > 0 {
+			durationh = fmt.Sprintf("%s | Overlap of %v sec", durationh, table.Overlap)
+		}
+		if table.MaxLag > 0 {
+			durationh = fmt.Sprintf("%s | Max lag of %v sec", durationh, table.MaxLag)
+		}
+
+		log.Trace("----------- | %s | Each %v sec | %s | Output by %v",
+			helpers.RightPad(table.Name, " ", 12-tlen),
 			table.Interval,
-			table.Hoursperbatch}
+			durationh,
+			table.Outputrowsperbatch)
+
+		workers["tables."+key] = newParam(provider, address, config, table)
+	}
+
+	// stagger the start of tables without offset
+	if config.Polling.Stagger > 0 {
+		var keys []string
+		for key, worker := range workers {
+			if worker.(*Param).input.offset == 0 {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for i, key := range keys {
+			workers[key].(*Param).stagger = time.Duration(i*config.Polling.Stagger) * time.Second
+		}
+	}
+
+	// set of active collectors
+	for key, collector := range config.Collectors {
+		if !collector.Active {
+			continue
+		}
+		log.Trace("----------- | %s | Each %v sec | Collector to %s",
+			helpers.RightPad(collector.Name, " ", 12-len(collector.Name)),
+			collector.Interval,
+			collector.Measurement)
 
 		output := Output{
 			influxdb.Url,
@@ -435,12 +1081,203 @@ func main() {
 			influxdb.Username,
 			influxdb.Password,
 			influxdb.Precision,
-			table.Outputrowsperbatch}
+			cfg.DefaultOutputRowsPerBatch,
+			fileOutput}
+
+		workers["collectors."+key] = &CollectorParam{
+			collector:    *collector,
+			provider:     provider,
+			address:      address,
+			querytimeout: config.Zabbix[provider].QueryTimeout,
+			output:       output}
+	}
+
+	return workers, nil
+}
+
+//
+// Start, stop or restart workers to match the given set.
+// A worker is restarted only if its parameters changed,
+// once its previous instance has finished its in-flight window.
+//
+func runWorkers(params map[string]gatherer, reload bool) {
 
-		p := &Param{input, output}
+	runningMu.Lock()
+	defer runningMu.Unlock()
 
+	for name, p := range params {
+		old, exists := running[name]
+		if exists && !old.stopped && !old.finished() && reflect.DeepEqual(old.param.spec(), p.spec()) {
+			continue
+		}
+
+		ctx, cancel := context.WithCancel(stopCtx)
+		w := &worker{param: p, cancel: cancel, done: make(chan struct{})}
+
+		// add before stopping the previous instance, so that
+		// the count of running workers never drops to zero
 		wg.Add(1)
-		go p.gather()
+		go func(w *worker, old *worker) {
+			defer wg.Done()
+			defer close(w.done)
+			if old != nil {
+				<-old.done
+			}
+			w.param.gather(ctx)
+		}(w, old)
+
+		if exists && !old.stopped {
+			log.Info("--- Reconfiguring %s", name)
+			old.cancel()
+		} else if reload {
+			log.Info("--- Starting %s", name)
+		}
+		running[name] = w
+	}
+
+	for name, w := range running {
+		if _, ok := params[name]; ok || w.stopped {
+			continue
+		}
+		log.Info("--- Stopping %s", name)
+		w.stopped = true
+		w.cancel()
+	}
+}
+
+// finished reports whether the worker goroutine returned, e.g. on error.
+func (w *worker) finished() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+//
+// Reload configuration on SIGHUP.
+// An invalid configuration is rejected and the running one is kept.
+//
+func reloadConfig() {
+
+	log.Info("--- Reloading configuration")
+
+	var newConfig cfg.TOMLConfig
+	if err := cfg.Parse(&newConfig); err != nil {
+		log.Error(0, "Configuration rejected, keeping the running one. %s", err)
+		return
+	}
+	if err := cfg.Validate(&newConfig); err != nil {
+		log.Error(0, "Configuration rejected, keeping the running one. %s", err)
+		return
+	}
+
+	// registry, output, logging, HTTP and stats are not reloaded
+	oldConfig := currentConfig()
+	if !reflect.DeepEqual(oldConfig.Output, newConfig.Output) {
+		log.Warn("Output settings changed, restart to apply them")
+	}
+	if !reflect.DeepEqual(oldConfig.Registry, newConfig.Registry) {
+		log.Warn("Registry settings changed, restart to apply them")
+	}
+	if !reflect.DeepEqual(oldConfig.Logging, newConfig.Logging) {
+		log.Warn("Logging settings changed, restart to apply them")
+	}
+	if !reflect.DeepEqual(oldConfig.HTTP, newConfig.HTTP) {
+		log.Warn("HTTP settings changed, restart to apply them")
+	}
+	if !reflect.DeepEqual(oldConfig.Stats, newConfig.Stats) {
+		log.Warn("Stats settings changed, restart to apply them")
+	}
+	newConfig.Registry = oldConfig.Registry
+	newConfig.Output = oldConfig.Output
+	newConfig.Logging = oldConfig.Logging
+	newConfig.HTTP = oldConfig.HTTP
+	newConfig.Stats = oldConfig.Stats
+
+	workers, err := newWorkers(newConfig)
+	if err != nil {
+		log.Error(0, "Configuration rejected, keeping the running one. %s", err)
+		return
+	}
+	if err := initRegistry(newConfig); err != nil {
+		log.Error(0, "Configuration rejected, keeping the running one. %s", err)
+		return
+	}
+
+	configMu.Lock()
+	config = newConfig
+	configMu.Unlock()
+	setLimits(newConfig)
+
+	runWorkers(workers, true)
+	log.Info("--- Configuration reloaded")
+}
+
+//
+// Main
+//
+func main() {
+
+	// command-line flag parsing
+	flag.Parse()
+
+	switch flag.Arg(0) {
+	case "":
+		run()
+	case "backfill":
+		os.Exit(backfill(flag.Args()[1:]))
+	case "export":
+		os.Exit(export(flag.Args()[1:]))
+	case "check":
+		os.Exit(check(flag.Args()[1:]))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q, must be one of: backfill, export, check\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
 	}
+}
+
+//
+// Poll active tables and collectors until stopped
+//
+func run() {
+
+	log.Info("***** Starting influxdb-zabbix *****")
+
+	// listen to System Signals
+	go listenToSystemSignals()
+
+	readConfig()
+	initLog()
+	if err := initRegistry(currentConfig()); err != nil {
+		log.Fatal(1, "%s", err)
+	}
+	if err := initOutput(currentConfig()); err != nil {
+		log.Fatal(1, "%s", err)
+	}
+	setLimits(currentConfig())
+	if err := initStatus(currentConfig()); err != nil {
+		log.Fatal(1, "%s", err)
+	}
+	initStats(currentConfig())
+	go watchLag(stopCtx)
+
+	log.Info("--- Start polling")
+
+	workers, err := newWorkers(currentConfig())
+	if err != nil {
+		log.Fatal(1, "%s", err)
+	}
+	runWorkers(workers, false)
+	close(started)
+
+	// all workers stopped on error
 	wg.Wait()
+	select {
+	case exitChan <- 1:
+	case <-stopCtx.Done():
+	}
+	select {} // listenToSystemSignals exits the process
 }
@@ -0,0 +1,352 @@
+package input
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Collector runs a user-defined query and maps its columns
+// to the tags, fields and timestamp of a measurement.
+// Unlike Input, it has no time window and no registry checkpoint.
+type Collector struct {
+	Provider    string
+	Address     string
+	Name        string
+	Query       string
+	QueryFile   string
+	Measurement string
+	Tags        []string
+	Fields      []string
+	Timestamp   string
+	Timeout     time.Duration
+	Result      []string
+
+	conn  *sql.DB
+	stmt  *sql.Stmt
+	query string
+}
+
+func NewCollector(provider string, address string, name string, query string, queryfile string,
+	measurement string, tags []string, fields []string, timestamp string, timeout time.Duration) Collector {
+	c := Collector{}
+	c.Provider = provider
+	c.Address = address
+	c.Name = name
+	c.Query = query
+	c.QueryFile = queryfile
+	c.Measurement = measurement
+	c.Tags = tags
+	c.Fields = fields
+	c.Timestamp = timestamp
+	c.Timeout = timeout
+	return c
+}
+
+// Prepare opens the connection and prepares the collector query.
+func (c *Collector) Prepare() error {
+
+	if c.stmt != nil {
+		return nil
+	}
+
+	query := c.Query
+	if len(c.QueryFile) > 0 {
+		template, err := readQueryFile(c.QueryFile)
+		if err != nil {
+			return err
+		}
+		query = template
+	}
+	c.query = query
+
+	provider, err := NewProvider(c.Provider)
+	if err != nil {
+		return err
+	}
+
+	dsn := provider.DSN(c.Address)
+	if c.Timeout > 0 {
+		dsn = provider.WithTimeout(dsn, c.Timeout)
+	}
+	conn, err := sql.Open(provider.DriverName(), dsn)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c.conn = conn
+	c.stmt = stmt
+	return nil
+}
+
+// SQL returns the collector query, set by Prepare before it connects
+// so that it is known even when the preparation fails.
+func (c *Collector) SQL() string {
+	return c.query
+}
+
+// Close releases the prepared statement and the connection.
+func (c *Collector) Close() error {
+	if c.stmt != nil {
+		c.stmt.Close()
+		c.stmt = nil
+	}
+	if c.conn != nil {
+		err := c.conn.Close()
+		c.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Collect runs the query and converts each row to line protocol.
+//   - tags columns: NULL values are left out
+//   - fields columns: typed from the declared type of the column, numbers
+//     are written as floats, booleans as booleans, anything else as strings,
+//     so that a field keeps its type whatever its values. NULL values are left out
+//   - timestamp column: Unix time in seconds, written in ms.
+//     When not defined, the collection time is used.
+func (c *Collector) Collect(ctx context.Context) error {
+
+	c.Result = nil
+
+	if err := c.Prepare(); err != nil {
+		return err
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	rows, err := c.stmt.QueryContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	index := make(map[string]int, len(columns))
+	for i, column := range columns {
+		index[strings.ToLower(column)] = i
+	}
+	lookup := func(names []string) ([]int, error) {
+		positions := make([]int, len(names))
+		for i, name := range names {
+			pos, ok := index[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("column %s not returned by query of collector %s", name, c.Name)
+			}
+			positions[i] = pos
+		}
+		return positions, nil
+	}
+	tagsPos, err := lookup(c.Tags)
+	if err != nil {
+		return err
+	}
+	fieldsPos, err := lookup(c.Fields)
+	if err != nil {
+		return err
+	}
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	fieldsType := make([]fieldType, len(fieldsPos))
+	for i, pos := range fieldsPos {
+		fieldsType[i] = columnFieldType(columnTypes[pos].DatabaseTypeName())
+	}
+	timestampPos := -1
+	if len(c.Timestamp) > 0 {
+		positions, err := lookup([]string{c.Timestamp})
+		if err != nil {
+			return err
+		}
+		timestampPos = positions[0]
+	}
+
+	// fetch result
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	resultInline := []string{}
+
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		var line []string
+		line = append(line, escapeMeasurement(c.Measurement))
+		for i, pos := range tagsPos {
+			if values[pos] == nil {
+				continue
+			}
+			value := toString(values[pos])
+			if len(value) == 0 {
+				continue
+			}
+			line = append(line, ","+escapeTag(c.Tags[i])+"="+escapeTag(value))
+		}
+
+		var fields []string
+		for i, pos := range fieldsPos {
+			if values[pos] == nil {
+				continue
+			}
+			value, err := fieldValue(values[pos], fieldsType[i])
+			if err != nil {
+				return fmt.Errorf("field %s of collector %s: %v", c.Fields[i], c.Name, err)
+			}
+			fields = append(fields, escapeTag(c.Fields[i])+"="+value)
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		line = append(line, " "+strings.Join(fields, ","))
+
+		timestamp := now
+		if timestampPos >= 0 && values[timestampPos] != nil {
+			clock, err := strconv.ParseInt(toString(values[timestampPos]), 10, 64)
+			if err != nil {
+				return fmt.Errorf("timestamp column %s of collector %s is not a Unix time: %v",
+					c.Timestamp, c.Name, err)
+			}
+			timestamp = clock * 1000
+		}
+		line = append(line, " "+strconv.FormatInt(timestamp, 10))
+
+		resultInline = append(resultInline, strings.Join(line, ""))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	c.Result = resultInline
+	return nil
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case []byte:
+		return strings.TrimSpace(string(v))
+	case string:
+		return strings.TrimSpace(v)
+	case time.Time:
+		return strconv.FormatInt(v.Unix(), 10)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// fieldType is the line protocol type of a field column.
+type fieldType int
+
+const (
+	fieldAny fieldType = iota // declared type unknown, e.g. an expression in sqlite
+	fieldFloat
+	fieldBool
+	fieldString
+)
+
+// columnFieldType returns the field type of a declared column type,
+// such as INT, BIGINT UNSIGNED, NUMERIC(10,2), FLOAT8 or VARCHAR(255).
+func columnFieldType(typeName string) fieldType {
+	name := strings.ToUpper(strings.TrimSpace(typeName))
+	if i := strings.Index(name, "("); i >= 0 {
+		name = strings.TrimSpace(name[:i])
+	}
+	name = strings.TrimSpace(strings.TrimPrefix(strings.TrimSuffix(name, " UNSIGNED"), "UNSIGNED "))
+
+	switch name {
+	case "":
+		return fieldAny
+	case "BOOL", "BOOLEAN":
+		return fieldBool
+	case "INT", "INTEGER", "TINYINT", "SMALLINT", "MEDIUMINT", "BIGINT", "INT2", "INT4", "INT8",
+		"DECIMAL", "NUMERIC", "FLOAT", "FLOAT4", "FLOAT8", "DOUBLE", "DOUBLE PRECISION", "REAL":
+		return fieldFloat
+	}
+	return fieldString
+}
+
+// fieldValue returns a value in line protocol, as a field of type t.
+// Values of an unknown type are typed from their scanned type, never parsed.
+func fieldValue(value interface{}, t fieldType) (string, error) {
+
+	if t == fieldAny {
+		switch value.(type) {
+		case int64, float64:
+			t = fieldFloat
+		case bool:
+			t = fieldBool
+		default:
+			t = fieldString
+		}
+	}
+
+	switch t {
+	case fieldFloat:
+		var f float64
+		switch v := value.(type) {
+		case int64:
+			f = float64(v)
+		case float64:
+			f = v
+		default:
+			var err error
+			if f, err = strconv.ParseFloat(toString(value), 64); err != nil {
+				return "", err
+			}
+		}
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return "", fmt.Errorf("%v cannot be written", f)
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+
+	case fieldBool:
+		switch v := value.(type) {
+		case bool:
+			return strconv.FormatBool(v), nil
+		case int64:
+			return strconv.FormatBool(v != 0), nil
+		}
+		b, err := strconv.ParseBool(toString(value))
+		if err != nil {
+			return "", err
+		}
+		return strconv.FormatBool(b), nil
+	}
+
+	s := toString(value)
+	return `"` + strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1) + `"`, nil
+}
+
+var measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+var tagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+func escapeMeasurement(s string) string {
+	return measurementEscaper.Replace(s)
+}
+
+func escapeTag(s string) string {
+	return tagEscaper.Replace(s)
+}
@@ -0,0 +1,44 @@
+package input
+
+import "math"
+
+// MaxNs is the largest ns of a Zabbix row.
+const MaxNs int64 = 999999999
+
+// Cursor is the key of a row in the (clock, ns, itemid) order of the queries.
+// Rows are read after the cursor, so that rows sharing a clock are neither
+// lost nor read twice across windows.
+type Cursor struct {
+	Clock  int64
+	Ns     int64
+	Itemid int64
+}
+
+// After returns the cursor after all rows of the clock.
+func After(clock int64) Cursor {
+	return Cursor{Clock: clock, Ns: MaxNs, Itemid: math.MaxInt64}
+}
+
+// Before returns the cursor before all rows of the clock.
+func Before(clock int64) Cursor {
+	return Cursor{Clock: clock}
+}
+
+// Less reports whether c is before o.
+func (c Cursor) Less(o Cursor) bool {
+	if c.Clock != o.Clock {
+		return c.Clock < o.Clock
+	}
+	if c.Ns != o.Ns {
+		return c.Ns < o.Ns
+	}
+	return c.Itemid < o.Itemid
+}
+
+// Max returns the last of the cursors.
+func Max(c Cursor, o Cursor) Cursor {
+	if c.Less(o) {
+		return o
+	}
+	return c
+}
@@ -0,0 +1,140 @@
+//go:build sqlite
+// +build sqlite
+
+package input
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"testing"
+
+	sqlitetest "github.com/zensqlmonitor/influxdb-zabbix/internal/sqlitetest"
+)
+
+func TestCursorOrder(t *testing.T) {
+
+	tests := []struct {
+		c, o Cursor
+		less bool
+	}{
+		{Before(10), After(10), true},
+		{After(9), Before(10), true},
+		{Before(10), Cursor{10, 0, 1}, true},
+		{Cursor{10, 0, 1}, Cursor{10, 1, 0}, true},
+		{Cursor{10, 5, 3}, Cursor{10, 5, 4}, true},
+		{Cursor{10, MaxNs, 7}, After(10), true},
+		{Cursor{10, 5, 3}, Cursor{10, 5, 3}, false},
+		{After(10), Before(11), true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.c.Less(tt.o); got != tt.less {
+			t.Errorf("%+v.Less(%+v) = %v, want %v", tt.c, tt.o, got, tt.less)
+		}
+		if tt.less {
+			if got := Max(tt.c, tt.o); got != tt.o {
+				t.Errorf("Max(%+v, %+v) = %+v", tt.c, tt.o, got)
+			}
+			if got := Max(tt.o, tt.c); got != tt.o {
+				t.Errorf("Max(%+v, %+v) = %+v", tt.o, tt.c, got)
+			}
+		}
+	}
+
+	if c := After(10); c.Ns != MaxNs || c.Itemid != math.MaxInt64 {
+		t.Errorf("After(10) = %+v", c)
+	}
+	if c := Before(10); c != (Cursor{Clock: 10}) {
+		t.Errorf("Before(10) = %+v", c)
+	}
+}
+
+// rows of the same clock, in the (clock, ns, itemid) order of the queries
+const sameClock int64 = 1483228900
+
+// newTestExtracter returns the extracter of the history table of a sqlite database
+// with the schema and sample rows of scripts/sqlite, then the statements given.
+func newTestExtracter(t *testing.T, statements ...string) (*Input, *sql.DB) {
+	t.Helper()
+
+	path := sqlitetest.NewDB(t, statements...)
+	conn, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	ext := NewExtracter("sqlite", path, "history", "", 0)
+	if err := ext.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ext.Close() })
+	return &ext, conn
+}
+
+func TestExtractSameClock(t *testing.T) {
+
+	ext, _ := newTestExtracter(t,
+		`INSERT INTO history (itemid, clock, value, ns) VALUES
+			(23662, 1483228900, 2, 0),
+			(23252, 1483228900, 1, 0),
+			(23252, 1483228900, 3, 7)`)
+
+	tests := []struct {
+		name    string
+		from    Cursor
+		endtime int64
+		rows    int
+		cursor  Cursor
+	}{
+		{"whole clock", After(sameClock - 1), sameClock, 3, Cursor{sameClock, 7, 23252}},
+		{"after first row", Cursor{sameClock, 0, 23252}, sameClock, 2, Cursor{sameClock, 7, 23252}},
+		{"after second row", Cursor{sameClock, 0, 23662}, sameClock, 1, Cursor{sameClock, 7, 23252}},
+		{"after last row", Cursor{sameClock, 7, 23252}, sameClock, 0, Cursor{}},
+		{"after clock", After(sameClock), sameClock + 60, 0, Cursor{}},
+		{"before clock", Before(sameClock), sameClock, 3, Cursor{sameClock, 7, 23252}},
+		{"window end before clock", After(1483228890), sameClock - 1, 0, Cursor{}},
+	}
+
+	for _, tt := range tests {
+		if err := ext.Extract(context.Background(), tt.from, tt.endtime); err != nil {
+			t.Fatal(err)
+		}
+		if len(ext.Result) != tt.rows || ext.Cursor != tt.cursor {
+			t.Errorf("%s: %d rows, cursor %+v, want %d rows, cursor %+v",
+				tt.name, len(ext.Result), ext.Cursor, tt.rows, tt.cursor)
+		}
+	}
+}
+
+// Rows of the window end clock arriving after the window was read
+// are read by the next window, the ones already read are not read again.
+func TestExtractSplitClock(t *testing.T) {
+
+	ext, conn := newTestExtracter(t,
+		`INSERT INTO history (itemid, clock, value, ns) VALUES
+			(23252, 1483228900, 1, 0),
+			(23662, 1483228900, 2, 0)`)
+
+	if err := ext.Extract(context.Background(), After(sameClock-1), sameClock); err != nil {
+		t.Fatal(err)
+	}
+	if len(ext.Result) != 2 || ext.Cursor != (Cursor{sameClock, 0, 23662}) {
+		t.Fatalf("first window: %d rows, cursor %+v", len(ext.Result), ext.Cursor)
+	}
+
+	// late rows of the window end clock, and of the next clock
+	if _, err := conn.Exec(`INSERT INTO history (itemid, clock, value, ns) VALUES
+		(23252, 1483228900, 3, 7),
+		(23252, 1483228901, 4, 0)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ext.Extract(context.Background(), ext.Cursor, sameClock+60); err != nil {
+		t.Fatal(err)
+	}
+	if len(ext.Result) != 2 || ext.Cursor != (Cursor{sameClock + 1, 0, 23252}) {
+		t.Fatalf("next window: %d rows, cursor %+v\n%v", len(ext.Result), ext.Cursor, ext.Result)
+	}
+}
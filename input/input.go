@@ -1,86 +1,238 @@
 package input
 
 import (
+	"context"
 	"database/sql"
-	"strings"
+	"fmt"
 	"time"
-	
-	helpers "github.com/zensqlmonitor/influxdb-zabbix/helpers"
-	
-	_ "github.com/go-sql-driver/mysql"
-	_ "github.com/lib/pq"
 )
 
 type Input struct {
 	Provider  string
 	Address   string
 	Tablename string
-	Starttime string
-	Endtime   string
+	QueryFile string
+	Timeout   time.Duration
+	Starttime int64
+	Endtime   int64
 	Maxclock  time.Time
+	Cursor    Cursor
 	Result    []string
+
+	// Checkpoint is the cursor of the rows read before, Reread the number
+	// of rows of the result at or before it, read again in an overlap
+	Checkpoint Cursor
+	Reread     int
+
+	// Hosts and Groups restrict the built-in query to these names, all when empty
+	Hosts  []string
+	Groups []string
+
+	provider Provider
+	conn     *sql.DB
+	stmt     *sql.Stmt
+	query    string
+	params   []string
 }
 
-func NewExtracter(provider string, address string, tablename string, starttime string, endtime string) Input {
+func NewExtracter(provider string, address string, tablename string, queryfile string,
+	timeout time.Duration) Input {
 	i := Input{}
 	i.Provider = provider
 	i.Address = address
 	i.Tablename = tablename
-	i.Starttime = starttime
-	i.Endtime = endtime
+	i.QueryFile = queryfile
+	i.Timeout = timeout
 	return i
 }
 
-func (input *Input) getSQL() string {
+// getSQL returns the table query and its parameter names in bind order.
+func (input *Input) getSQL() (string, []string, error) {
 
-	var query string
+	var template string
+	var err error
 
-	switch input.Provider {
-	case "postgres":
-		query = pgSQL(input.Tablename)
-	case "mysql":
-		query = mySQL(input.Tablename)
-	default:
-		panic("unrecognized provider")
+	if len(input.QueryFile) > 0 {
+		// user-defined query
+		template, err = readQueryFile(input.QueryFile)
+	} else {
+		template, err = input.provider.Query(input.Tablename)
+		template = filterQuery(template, input.Hosts, input.Groups)
+	}
+	if err != nil {
+		return "", nil, err
 	}
 
-	return strings.Replace(
-		strings.Replace(
-			query,
-			"##STARTDATE##", input.Starttime, -1),
-		    "##ENDDATE##", input.Endtime, -1)
+	query, params := compileQuery(input.provider, template)
+	return query, params, nil
 }
 
-func (input *Input) Extract() error {
+// Prepare opens the connection and prepares the table query.
+// The statement is kept and reused for each window.
+func (input *Input) Prepare() error {
+
+	if input.stmt != nil {
+		return nil
+	}
+
+	provider, err := NewProvider(input.Provider)
+	if err != nil {
+		return err
+	}
+	input.provider = provider
 
 	// get query
-	query := input.getSQL()
+	query, params, err := input.getSQL()
+	if err != nil {
+		return err
+	}
+	input.query = query
 
-	//fmt.Println(fmt.Sprintf("------------------- %s: %s", input.Tablename, query))
+	// open a connection, with the time budget of the queries if any
+	dsn := provider.DSN(input.Address)
+	if input.Timeout > 0 {
+		dsn = provider.WithTimeout(dsn, input.Timeout)
+	}
+	conn, err := sql.Open(provider.DriverName(), dsn)
+	if err != nil {
+		return err
+	}
+
+	// check the tables of the built-in query
+	if len(input.QueryFile) == 0 {
+		if err := provider.DetectSchema(conn, input.Tablename); err != nil {
+			conn.Close()
+			return err
+		}
+	}
 
-	// open a connection
-	conn, err := sql.Open(input.Provider, input.Address)
+	stmt, err := conn.Prepare(query)
 	if err != nil {
+		conn.Close()
 		return err
 	}
-	defer conn.Close()
 
-	rows, err := conn.Query(query)
+	input.conn = conn
+	input.stmt = stmt
+	input.params = params
+	return nil
+}
+
+// SQL returns the table query, set by Prepare before it connects
+// so that it is known even when the schema check or the preparation fails.
+func (input *Input) SQL() string {
+	return input.query
+}
+
+// Close releases the prepared statement and the connection.
+func (input *Input) Close() error {
+	if input.stmt != nil {
+		input.stmt.Close()
+		input.stmt = nil
+	}
+	if input.conn != nil {
+		err := input.conn.Close()
+		input.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Extract runs the table query for the rows after the from cursor
+// and up to endtime included, a Unix time in seconds.
+// Cursor is set to the key of the last row, the zero Cursor if none.
+// The query is cancelled when ctx is done or Timeout is over.
+func (input *Input) Extract(ctx context.Context, from Cursor, endtime int64) error {
+
+	input.Starttime = from.Clock
+	input.Endtime = endtime
+	input.Result = nil
+	input.Maxclock = time.Time{}
+	input.Cursor = Cursor{}
+	input.Reread = 0
+
+	if err := input.Prepare(); err != nil {
+		return err
+	}
+	if input.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, input.Timeout)
+		defer cancel()
+	}
+
+	// bind cursor, window end and filters
+	args := make([]interface{}, len(input.params))
+	var hosts, groups int
+	for i, param := range input.params {
+		switch param {
+		case HostNamePlaceholder:
+			if hosts < len(input.Hosts) {
+				args[i] = input.Hosts[hosts]
+			}
+			hosts++
+		case GroupNamePlaceholder:
+			if groups < len(input.Groups) {
+				args[i] = input.Groups[groups]
+			}
+			groups++
+		case StartDatePlaceholder:
+			args[i] = from.Clock
+		case EndDatePlaceholder:
+			args[i] = input.Endtime
+		case LastNsPlaceholder:
+			args[i] = from.Ns
+		case LastItemIdPlaceholder:
+			args[i] = from.Itemid
+		}
+	}
+
+	rows, err := input.stmt.QueryContext(ctx, args...)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
+	// result contract: line protocol, clock in ms, then optional itemid and ns,
+	// rows being ordered by clock, ns and itemid
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if len(columns) < 2 || len(columns) > 4 {
+		return fmt.Errorf("query for %s must return 2 to 4 columns, got %d",
+			input.Tablename, len(columns))
+	}
+
 	// fetch result
 	resultInline := []string{}
 	var clock string
+	var itemid sql.NullInt64
+	var ns sql.NullInt64
 
 	for rows.Next() {
 		var result string
-		if err := rows.Scan(&result, &clock); err != nil {
+		dest := []interface{}{&result, &clock}
+		if len(columns) >= 3 {
+			dest = append(dest, &itemid)
+		}
+		if len(columns) == 4 {
+			dest = append(dest, &ns)
+		}
+		if err := rows.Scan(dest...); err != nil {
 			return err
 		}
 		resultInline = append(resultInline, result)
+
+		// rows are ordered: counted until the first one after the checkpoint
+		if len(resultInline)-1 == input.Reread && input.Checkpoint != (Cursor{}) {
+			_, cursor, err := input.rowCursor(clock, itemid, ns)
+			if err != nil {
+				return err
+			}
+			if !input.Checkpoint.Less(cursor) {
+				input.Reread++
+			}
+		}
 	}
 	if err := rows.Err(); err != nil {
 		return err
@@ -89,14 +241,33 @@ func (input *Input) Extract() error {
 
 	input.Result = resultInline
 
-	// saved max clock from the result set
+	// max clock and cursor from the last row,
+	// after all rows of its clock when itemid or ns are not returned
 	if len(clock) > 0 {
-		lastclock, err := helpers.MsToTime(strings.Trim(clock, " "))
+		lastclock, cursor, err := input.rowCursor(clock, itemid, ns)
 		if err != nil {
 			return err
 		}
 		input.Maxclock = lastclock
+		input.Cursor = cursor
 	}
 
 	return nil
 }
+
+// rowCursor returns the clock and the cursor of a row,
+// after all rows of its clock when itemid or ns are not returned.
+func (input *Input) rowCursor(clock string, itemid sql.NullInt64, ns sql.NullInt64) (time.Time, Cursor, error) {
+	rowclock, err := input.provider.ToTime(clock)
+	if err != nil {
+		return rowclock, Cursor{}, err
+	}
+	cursor := After(rowclock.Unix())
+	if itemid.Valid {
+		cursor.Itemid = itemid.Int64
+	}
+	if ns.Valid {
+		cursor.Ns = ns.Int64
+	}
+	return rowclock, cursor, nil
+}
@@ -0,0 +1,94 @@
+//go:build sqlite
+// +build sqlite
+
+package input
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The query is known when Prepare fails, to be printed by the check command.
+func TestSQLOnPrepareFailure(t *testing.T) {
+
+	// no Zabbix schema: the schema check and the preparation fail
+	path := filepath.Join(t.TempDir(), "empty.db")
+
+	ext := NewExtracter("sqlite", path, "history", "", 0)
+	if err := ext.Prepare(); err == nil {
+		t.Fatal("prepared without the Zabbix schema, want an error")
+	}
+	defer ext.Close()
+	if !strings.Contains(ext.SQL(), "FROM history") {
+		t.Errorf("table query %q", ext.SQL())
+	}
+
+	c := NewCollector("sqlite", path, "hosts", "SELECT host, status FROM hosts", "",
+		"hosts", []string{"host"}, []string{"status"}, "", 0)
+	if err := c.Prepare(); err == nil {
+		t.Fatal("prepared without the Zabbix schema, want an error")
+	}
+	defer c.Close()
+	if c.SQL() != "SELECT host, status FROM hosts" {
+		t.Errorf("collector query %q", c.SQL())
+	}
+}
+
+// Rows of a collector query mapped to line protocol: escaping, NULL values,
+// fields typed from the declared column types, timestamps in ms.
+func TestCollectLines(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "collect.db")
+	conn, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Exec(`CREATE TABLE stats (
+		host TEXT, grp TEXT, value DOUBLE, count BIGINT, code VARCHAR(10), up BOOLEAN, clock INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		row  string
+		line string
+	}{
+		{"types", `'db 1', 'Zabbix servers', 1.5, 42, 'ok', 1, 1483228830`,
+			`stats,host=db\ 1,grp=Zabbix\ servers value=1.5,count=42,code="ok",up=true 1483228830000`},
+		{"escaping", `'a,b=c', 'g', 2, 0, 'say "hi" \o/', 0, 1483228830`,
+			`stats,host=a\,b\=c,grp=g value=2,count=0,code="say \"hi\" \\o/",up=false 1483228830000`},
+		{"numeric text stays a string", `'h', 'g', 3, 1, '007', 1, 1483228830`,
+			`stats,host=h,grp=g value=3,count=1,code="007",up=true 1483228830000`},
+		{"exponent text stays a string", `'h', 'g', 3, 1, '1e5', 1, 1483228830`,
+			`stats,host=h,grp=g value=3,count=1,code="1e5",up=true 1483228830000`},
+		{"NULL tag and fields left out", `NULL, 'g', NULL, 7, NULL, NULL, 1483228830`,
+			`stats,grp=g count=7 1483228830000`},
+		{"empty tag left out", `'', 'g', 1, 1, 'x', 1, 1483228830`,
+			`stats,grp=g value=1,count=1,code="x",up=true 1483228830000`},
+		{"all fields NULL", `'h', 'g', NULL, NULL, NULL, NULL, 1483228830`, ``},
+	}
+
+	c := NewCollector("sqlite", path, "stats", "SELECT host, grp, value, count, code, up, clock FROM stats", "",
+		"stats", []string{"host", "grp"}, []string{"value", "count", "code", "up"}, "clock", 0)
+	defer c.Close()
+
+	for _, tt := range tests {
+		if _, err := conn.Exec(`DELETE FROM stats`); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Exec(`INSERT INTO stats VALUES (` + tt.row + `)`); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := c.Collect(context.Background()); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := strings.Join(c.Result, "\n"); got != tt.line {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, got, tt.line)
+		}
+	}
+}
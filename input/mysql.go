@@ -1,19 +1,75 @@
 package input
 
-import ()
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
 
-func mySQL(tablename string) string {
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// MySQLProvider implements Provider for MariaDB/MySQL.
+type MySQLProvider struct{}
+
+func NewMySQL() Provider {
+	return &MySQLProvider{}
+}
+
+func (_ *MySQLProvider) DriverName() string {
+	return "mysql"
+}
+
+// DSN adds the sql mode needed by the queries to concatenate with ||.
+func (_ *MySQLProvider) DSN(address string) string {
+	if strings.Contains(address, "sql_mode=") {
+		return address
+	}
+	return withParam(address, "sql_mode='PIPES_AS_CONCAT'")
+}
+
+// WithTimeout sets max_execution_time, a system variable set on connect.
+// It is supported by MySQL 5.7.8+, not by MariaDB.
+func (_ *MySQLProvider) WithTimeout(dsn string, timeout time.Duration) string {
+	if strings.Contains(dsn, "max_execution_time=") {
+		return dsn
+	}
+	return withParam(dsn, "max_execution_time="+strconv.FormatInt(int64(timeout/time.Millisecond), 10))
+}
+
+func (_ *MySQLProvider) Query(tablename string) (string, error) {
+	return mySQL(tablename)
+}
+
+func (_ *MySQLProvider) BindVar(n int) string {
+	return "?"
+}
+
+func (_ *MySQLProvider) ToTime(clock string) (time.Time, error) {
+	return msToTime(clock)
+}
+
+func (_ *MySQLProvider) DetectSchema(conn *sql.DB, tablename string) error {
+	return detectTables(conn, tablename, "")
+}
+
+func init() {
+	Register("mysql", NewMySQL)
+}
+
+func mySQL(tablename string) (string, error) {
 	switch tablename {
 	case "history":
-		return mysqlHistory
+		return mysqlHistory, nil
 	case "history_uint":
-		return mysqlHistoryUInt
+		return mysqlHistoryUInt, nil
 	case "trends":
-		return mysqlTrends
+		return mysqlTrends, nil
 	case "trends_uint":
-		return mysqlTrendsUInt
+		return mysqlTrendsUInt, nil
 	default:
-		panic("unrecognized tablename")
+		return "", errors.New("unrecognized tablename " + tablename)
 	}
 }
 
@@ -47,14 +103,19 @@ replace(replace(CASE
 -- timestamp (in ms)
 || ' ' || CAST((tre.clock * 1000.) as char) as INLINE
 ,  CAST((tre.clock * 1000.) as char) as clock
+,  tre.itemid
+,  0 as ns
 FROM trends tre 
 INNER JOIN items ite on ite.itemid = tre.itemid
 INNER JOIN hosts hos on hos.hostid = ite.hostid
 INNER JOIN hosts_groups hg on hg.hostid = hos.hostid
 INNER JOIN hstgrp grp on grp.groupid = hg.groupid
 WHERE grp.internal=0
-   AND tre.clock > ##STARTDATE##
-   AND tre.clock <= ##ENDDATE##;
+   AND tre.clock >= ##STARTDATE##
+   AND (tre.clock > ##STARTDATE##
+     OR (tre.clock = ##STARTDATE## AND tre.itemid > ##LASTITEMID##))
+   AND tre.clock <= ##ENDDATE##
+ORDER BY tre.clock, tre.itemid
 `
 
 const mysqlTrendsUInt string = `SELECT 
@@ -87,14 +148,19 @@ replace(replace(CASE
 -- timestamp (in ms)
 || ' ' || CAST((tre.clock * 1000.) as char) as INLINE
 ,  CAST((tre.clock * 1000.) as char) as clock
+,  tre.itemid
+,  0 as ns
 FROM trends tre 
 INNER JOIN items ite on ite.itemid = tre.itemid
 INNER JOIN hosts hos on hos.hostid = ite.hostid
 INNER JOIN hosts_groups hg on hg.hostid = hos.hostid
 INNER JOIN hstgrp grp on grp.groupid = hg.groupid
 WHERE grp.internal=0
-   AND tre.clock > ##STARTDATE##
-   AND tre.clock <= ##ENDDATE##;
+   AND tre.clock >= ##STARTDATE##
+   AND (tre.clock > ##STARTDATE##
+     OR (tre.clock = ##STARTDATE## AND tre.itemid > ##LASTITEMID##))
+   AND tre.clock <= ##ENDDATE##
+ORDER BY tre.clock, tre.itemid
 `
 
 const mysqlHistory string = `SELECT 
@@ -125,14 +191,20 @@ replace(replace(CASE
 -- timestamp (in ms)
 || ' ' || CAST((his.clock * 1000.) as char) as INLINE
 ,  CAST((his.clock * 1000.) as char) as clock
+,  his.itemid
+,  his.ns
 FROM history his
 INNER JOIN items ite on ite.itemid = his.itemid
 INNER JOIN hosts hos on hos.hostid = ite.hostid
 INNER JOIN hosts_groups hg on hg.hostid = hos.hostid
 INNER JOIN hstgrp grp on grp.groupid = hg.groupid
 WHERE grp.internal=0
-   AND his.clock > ##STARTDATE##
-   AND his.clock <= ##ENDDATE##;
+   AND his.clock >= ##STARTDATE##
+   AND (his.clock > ##STARTDATE##
+     OR (his.clock = ##STARTDATE## AND his.ns > ##LASTNS##)
+     OR (his.clock = ##STARTDATE## AND his.ns = ##LASTNS## AND his.itemid > ##LASTITEMID##))
+   AND his.clock <= ##ENDDATE##
+ORDER BY his.clock, his.ns, his.itemid
 `
 
 const mysqlHistoryUInt string = `SELECT 
@@ -163,12 +235,18 @@ replace(replace(CASE
 -- timestamp (in ms)
 || ' ' || CAST((his.clock * 1000.) as char) as INLINE
 ,  CAST((his.clock * 1000.) as char) as clock
+,  his.itemid
+,  his.ns
 FROM history_uint his
 INNER JOIN items ite on ite.itemid = his.itemid
 INNER JOIN hosts hos on hos.hostid = ite.hostid
 INNER JOIN hosts_groups hg on hg.hostid = hos.hostid
 INNER JOIN hstgrp grp on grp.groupid = hg.groupid
 WHERE grp.internal=0
-   AND his.clock > ##STARTDATE##
-   AND his.clock <= ##ENDDATE##;
+   AND his.clock >= ##STARTDATE##
+   AND (his.clock > ##STARTDATE##
+     OR (his.clock = ##STARTDATE## AND his.ns > ##LASTNS##)
+     OR (his.clock = ##STARTDATE## AND his.ns = ##LASTNS## AND his.itemid > ##LASTITEMID##))
+   AND his.clock <= ##ENDDATE##
+ORDER BY his.clock, his.ns, his.itemid
 `
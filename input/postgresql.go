@@ -1,19 +1,74 @@
 package input
 
-import ()
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
 
-func pgSQL(tablename string) string {
+	_ "github.com/lib/pq"
+)
+
+// PostgresProvider implements Provider for PostgreSQL.
+type PostgresProvider struct{}
+
+func NewPostgres() Provider {
+	return &PostgresProvider{}
+}
+
+func (_ *PostgresProvider) DriverName() string {
+	return "postgres"
+}
+
+func (_ *PostgresProvider) DSN(address string) string {
+	return address
+}
+
+// WithTimeout sets statement_timeout, sent as a run-time parameter by lib/pq.
+func (_ *PostgresProvider) WithTimeout(dsn string, timeout time.Duration) string {
+	if strings.Contains(dsn, "statement_timeout=") {
+		return dsn
+	}
+	param := "statement_timeout=" + strconv.FormatInt(int64(timeout/time.Millisecond), 10)
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		return withParam(dsn, param)
+	}
+	return dsn + " " + param
+}
+
+func (_ *PostgresProvider) Query(tablename string) (string, error) {
+	return pgSQL(tablename)
+}
+
+func (_ *PostgresProvider) BindVar(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (_ *PostgresProvider) ToTime(clock string) (time.Time, error) {
+	return msToTime(clock)
+}
+
+func (_ *PostgresProvider) DetectSchema(conn *sql.DB, tablename string) error {
+	return detectTables(conn, tablename, "public.")
+}
+
+func init() {
+	Register("postgres", NewPostgres)
+}
+
+func pgSQL(tablename string) (string, error) {
 	switch tablename {
 	case "history":
-		return pgsqlHistory
+		return pgsqlHistory, nil
 	case "history_uint":
-		return pgsqlHistoryUInt
+		return pgsqlHistoryUInt, nil
 	case "trends":
-		return pgsqlTrends
+		return pgsqlTrends, nil
 	case "trends_uint":
-		return pgsqlTrendsUInt
+		return pgsqlTrendsUInt, nil
 	default:
-		panic("unrecognized tablename")
+		return "", errors.New("unrecognized tablename " + tablename)
 	}
 }
 
@@ -47,14 +102,19 @@ replace(replace(CASE
 -- timestamp (in ms)
 || ' ' || CAST((tre.clock * 1000.) as char(14)) as INLINE
 ,  CAST((tre.clock * 1000.) as char(14)) as clock
+,  tre.itemid
+,  0 as ns
 FROM public.trends tre
 INNER JOIN public.items ite on ite.itemid = tre.itemid
 INNER JOIN public.hosts hos on hos.hostid = ite.hostid
 INNER JOIN public.hosts_groups hg on hg.hostid = hos.hostid
 INNER JOIN public.hstgrp grp on grp.groupid = hg.groupid
 WHERE grp.internal=0
-   AND tre.clock > ##STARTDATE##
-   AND tre.clock <= ##ENDDATE##;
+   AND tre.clock >= ##STARTDATE##
+   AND (tre.clock > ##STARTDATE##
+     OR (tre.clock = ##STARTDATE## AND tre.itemid > ##LASTITEMID##))
+   AND tre.clock <= ##ENDDATE##
+ORDER BY tre.clock, tre.itemid
 `
 const pgsqlTrendsUInt string = `SELECT 
 -- measurement
@@ -86,14 +146,19 @@ replace(replace(CASE
 -- timestamp (in ms)
 || ' ' || CAST((tre.clock * 1000.) as char(14)) as INLINE
 ,  CAST((tre.clock * 1000.) as char(14)) as clock
+,  tre.itemid
+,  0 as ns
 FROM public.trends_uint tre
 INNER JOIN public.items ite on ite.itemid = tre.itemid
 INNER JOIN public.hosts hos on hos.hostid = ite.hostid
 INNER JOIN public.hosts_groups hg on hg.hostid = hos.hostid
 INNER JOIN public.hstgrp grp on grp.groupid = hg.groupid
 WHERE grp.internal=0
-   AND tre.clock > ##STARTDATE##
-   AND tre.clock <= ##ENDDATE##;
+   AND tre.clock >= ##STARTDATE##
+   AND (tre.clock > ##STARTDATE##
+     OR (tre.clock = ##STARTDATE## AND tre.itemid > ##LASTITEMID##))
+   AND tre.clock <= ##ENDDATE##
+ORDER BY tre.clock, tre.itemid
 `
 
 const pgsqlHistory string = `SELECT 
@@ -124,14 +189,20 @@ replace(replace(CASE
 -- timestamp (in ms)
 || ' ' || CAST((his.clock * 1000.) + round(his.ns / 1000000., 0) as char(14)) as INLINE
 ,  CAST((his.clock * 1000.) as char(14)) as clock
+,  his.itemid
+,  his.ns
 FROM public.history his
 INNER JOIN public.items ite on ite.itemid = his.itemid
 INNER JOIN public.hosts hos on hos.hostid = ite.hostid
 INNER JOIN public.hosts_groups hg on hg.hostid = hos.hostid
 INNER JOIN public.hstgrp grp on grp.groupid = hg.groupid
 WHERE grp.internal=0
-   AND his.clock > ##STARTDATE##
-   AND his.clock <= ##ENDDATE##;
+   AND his.clock >= ##STARTDATE##
+   AND (his.clock > ##STARTDATE##
+     OR (his.clock = ##STARTDATE## AND his.ns > ##LASTNS##)
+     OR (his.clock = ##STARTDATE## AND his.ns = ##LASTNS## AND his.itemid > ##LASTITEMID##))
+   AND his.clock <= ##ENDDATE##
+ORDER BY his.clock, his.ns, his.itemid
 `
 
 const pgsqlHistoryUInt string = `SELECT 
@@ -162,12 +233,18 @@ replace(replace(CASE
 -- timestamp (in ms)
 || ' ' || CAST((his.clock * 1000.) + round(his.ns / 1000000., 0) as char(14)) as INLINE
 ,  CAST((his.clock * 1000.) as char(14)) as clock
+,  his.itemid
+,  his.ns
 FROM public.history_uint his
 INNER JOIN public.items ite on ite.itemid = his.itemid
 INNER JOIN public.hosts hos on hos.hostid = ite.hostid
 INNER JOIN public.hosts_groups hg on hg.hostid = hos.hostid
 INNER JOIN public.hstgrp grp on grp.groupid = hg.groupid
 WHERE grp.internal=0
-   AND his.clock > ##STARTDATE##
-   AND his.clock <= ##ENDDATE##;
+   AND his.clock >= ##STARTDATE##
+   AND (his.clock > ##STARTDATE##
+     OR (his.clock = ##STARTDATE## AND his.ns > ##LASTNS##)
+     OR (his.clock = ##STARTDATE## AND his.ns = ##LASTNS## AND his.itemid > ##LASTITEMID##))
+   AND his.clock <= ##ENDDATE##
+ORDER BY his.clock, his.ns, his.itemid
 `
@@ -0,0 +1,149 @@
+package input
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	helpers "github.com/zensqlmonitor/influxdb-zabbix/helpers"
+)
+
+// Provider represents behaviors of a Zabbix database backend.
+type Provider interface {
+	// DriverName returns the database/sql driver to open connections with.
+	DriverName() string
+	// DSN normalises the configured address into a connection string.
+	DSN(address string) string
+	// WithTimeout sets a server-side time budget for the statements
+	// of the connections opened with dsn.
+	WithTimeout(dsn string, timeout time.Duration) string
+	// Query returns the built-in query template of a Zabbix table,
+	// with the placeholders of user-defined queries.
+	Query(tablename string) (string, error)
+	// BindVar returns the marker of the n-th bind parameter (counting from one).
+	BindVar(n int) string
+	// ToTime converts a clock returned by the queries.
+	ToTime(clock string) (time.Time, error)
+	// DetectSchema checks the tables read by the query of a Zabbix table
+	// exist and can be selected.
+	DetectSchema(conn *sql.DB, tablename string) error
+}
+
+type providerType func() Provider
+
+var providers = make(map[string]providerType)
+
+// Register makes a provider available by the given name.
+func Register(name string, provider providerType) {
+	if provider == nil {
+		panic("input: register provider is nil")
+	}
+	if _, dup := providers[name]; dup {
+		panic("input: register called twice for provider \"" + name + "\"")
+	}
+	providers[name] = provider
+}
+
+// NewProvider returns the provider registered by the given name.
+func NewProvider(name string) (Provider, error) {
+	provider, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q, must be one of %s",
+			name, strings.Join(Providers(), ", "))
+	}
+	return provider(), nil
+}
+
+// Providers returns the names of the registered providers.
+func Providers() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// zabbixTables returns the tables read by the built-in query of a Zabbix table.
+func zabbixTables(tablename string) []string {
+	return []string{
+		tablename,
+		"items",
+		"hosts",
+		"hosts_groups",
+		"hstgrp",
+		"items_applications",
+		"applications",
+	}
+}
+
+// detectTables checks each table read by a built-in query can be selected,
+// prefix being the schema of the tables if any.
+func detectTables(conn *sql.DB, tablename string, prefix string) error {
+	for _, table := range zabbixTables(tablename) {
+		rows, err := conn.Query("SELECT 1 FROM " + prefix + table + " WHERE 1=0")
+		if err != nil {
+			return fmt.Errorf("table %s%s cannot be selected: %v", prefix, table, err)
+		}
+		rows.Close()
+	}
+	return nil
+}
+
+// withParam adds a parameter to a connection string in URL form.
+func withParam(dsn string, param string) string {
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + param
+	}
+	return dsn + "?" + param
+}
+
+// msToTime converts a clock in milliseconds.
+func msToTime(clock string) (time.Time, error) {
+	return helpers.MsToTime(strings.TrimSpace(clock))
+}
+
+// Ping checks the Zabbix database of a provider can be reached.
+func Ping(ctx context.Context, name string, address string) error {
+	provider, err := NewProvider(name)
+	if err != nil {
+		return err
+	}
+	conn, err := sql.Open(provider.DriverName(), provider.DSN(address))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.PingContext(ctx)
+}
+
+// Earliest returns the clock of the oldest row of a Zabbix table,
+// the zero Time when the table is empty.
+func Earliest(ctx context.Context, name string, address string, tablename string) (time.Time, error) {
+	for _, r := range tablename {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return time.Time{}, fmt.Errorf("table name %q is not a plain identifier", tablename)
+		}
+	}
+	provider, err := NewProvider(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	conn, err := sql.Open(provider.DriverName(), provider.DSN(address))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer conn.Close()
+
+	var clock sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT MIN(clock) FROM "+tablename).Scan(&clock); err != nil {
+		return time.Time{}, err
+	}
+	if !clock.Valid {
+		return time.Time{}, nil
+	}
+	return time.Unix(clock.Int64, 0), nil
+}
@@ -0,0 +1,278 @@
+//go:build sqlite
+// +build sqlite
+
+package input
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// sqliteDriver is the database/sql driver of the sqlite provider.
+// It adds the PostgreSQL functions used by the queries.
+const sqliteDriver string = "sqlite3_zabbix"
+
+// SQLiteProvider implements Provider for SQLite.
+type SQLiteProvider struct{}
+
+func NewSQLite() Provider {
+	return &SQLiteProvider{}
+}
+
+func (_ *SQLiteProvider) DriverName() string {
+	return sqliteDriver
+}
+
+func (_ *SQLiteProvider) DSN(address string) string {
+	return address
+}
+
+// WithTimeout leaves dsn unchanged: an embedded database has no statement timeout,
+// queries are cancelled by their context instead.
+func (_ *SQLiteProvider) WithTimeout(dsn string, timeout time.Duration) string {
+	return dsn
+}
+
+func (_ *SQLiteProvider) Query(tablename string) (string, error) {
+	return sqliteSQL(tablename)
+}
+
+func (_ *SQLiteProvider) BindVar(n int) string {
+	return "?"
+}
+
+func (_ *SQLiteProvider) ToTime(clock string) (time.Time, error) {
+	return msToTime(clock)
+}
+
+func (_ *SQLiteProvider) DetectSchema(conn *sql.DB, tablename string) error {
+	return detectTables(conn, tablename, "")
+}
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("split_part", splitPart, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("key_params", keyParams, true)
+		},
+	})
+	Register("sqlite", NewSQLite)
+}
+
+// splitPart splits s on delimiter and returns the n-th field (counting from one).
+func splitPart(s string, delimiter string, n int) string {
+	parts := strings.Split(s, delimiter)
+	if n < 1 || n > len(parts) {
+		return ""
+	}
+	return parts[n-1]
+}
+
+// keyParams returns the parameters of an item key, between the first '[' and the last ']'.
+func keyParams(key string) string {
+	start := strings.Index(key, "[")
+	end := strings.LastIndex(key, "]")
+	if start < 0 || end <= start+1 {
+		return ""
+	}
+	return key[start+1 : end]
+}
+
+func sqliteSQL(tablename string) (string, error) {
+	switch tablename {
+	case "history":
+		return sqliteHistory, nil
+	case "history_uint":
+		return sqliteHistoryUInt, nil
+	case "trends":
+		return sqliteTrends, nil
+	case "trends_uint":
+		return sqliteTrendsUInt, nil
+	default:
+		return "", errors.New("unrecognized tablename " + tablename)
+	}
+}
+
+const sqliteTrends string = `SELECT 
+-- measurement
+replace(replace(CASE
+    WHEN (instr(ite.name, '$2') > 0) AND (instr(ite.name, '$4') > 0) 
+      THEN replace(replace(ite.name, '$2', split_part(key_params(ite.key_), ',', 2)), '$4', split_part(key_params(ite.key_), ',', 4))
+    WHEN (instr(ite.name, '$1') > 0) AND (instr(ite.name, '$2') > 0) 
+      THEN replace(replace(ite.name, '$1', split_part(key_params(ite.key_), ',', 1)), '$2', split_part(key_params(ite.key_), ',', 2))
+    WHEN (instr(ite.name, '$1') > 0) 
+       THEN replace(ite.name, '$1', split_part(key_params(ite.key_), ',', 1))
+    WHEN (instr(ite.name, '$2') > 0) 
+       THEN replace(ite.name, '$2', split_part(key_params(ite.key_), ',', 2))
+    WHEN (instr(ite.name, '$3') > 0)
+       THEN replace(ite.name, '$3', split_part(key_params(ite.key_), ',', 3))
+    WHEN (instr(ite.name, '$1') > 0) AND (instr(ite.name, '$3') > 0)
+       THEN replace(replace(ite.name, '$1', split_part(key_params(ite.key_), ',', 1)), '$3', split_part(key_params(ite.key_), ',', 3))
+    ELSE ite.name
+  END, ',', ''), ' ', '\ ') 
+-- tags
+|| ',host_name=' || replace(hos.name, ' ', '\ ')
+|| ',group_name=' || replace(grp.name, ' ', '\ ')
+|| ',applications=' || coalesce(replace(replace((SELECT group_concat(app.name || ' ', ',')
+    FROM items_applications iap
+    INNER JOIN applications app on app.applicationid = iap.applicationid
+    WHERE iap.itemid = ite.itemid), ' ', '\ '), ',', ''), 'N.A.')
+|| ' value_min=' || CAST(tre.value_min as text)
+|| ',value_avg=' || CAST(tre.value_avg as text)
+|| ',value_max=' || CAST(tre.value_max as text)
+-- timestamp (in ms)
+|| ' ' || CAST(tre.clock * 1000 as text) as INLINE
+,  CAST(tre.clock * 1000 as text) as clock
+,  tre.itemid
+,  0 as ns
+FROM trends tre
+INNER JOIN items ite on ite.itemid = tre.itemid
+INNER JOIN hosts hos on hos.hostid = ite.hostid
+INNER JOIN hosts_groups hg on hg.hostid = hos.hostid
+INNER JOIN hstgrp grp on grp.groupid = hg.groupid
+WHERE grp.internal=0
+   AND tre.clock >= ##STARTDATE##
+   AND (tre.clock > ##STARTDATE##
+     OR (tre.clock = ##STARTDATE## AND tre.itemid > ##LASTITEMID##))
+   AND tre.clock <= ##ENDDATE##
+ORDER BY tre.clock, tre.itemid
+`
+
+const sqliteTrendsUInt string = `SELECT 
+-- measurement
+replace(replace(CASE
+    WHEN (instr(ite.name, '$2') > 0) AND (instr(ite.name, '$4') > 0) 
+      THEN replace(replace(ite.name, '$2', split_part(key_params(ite.key_), ',', 2)), '$4', split_part(key_params(ite.key_), ',', 4))
+    WHEN (instr(ite.name, '$1') > 0) AND (instr(ite.name, '$2') > 0) 
+      THEN replace(replace(ite.name, '$1', split_part(key_params(ite.key_), ',', 1)), '$2', split_part(key_params(ite.key_), ',', 2))
+    WHEN (instr(ite.name, '$1') > 0) 
+       THEN replace(ite.name, '$1', split_part(key_params(ite.key_), ',', 1))
+    WHEN (instr(ite.name, '$2') > 0) 
+       THEN replace(ite.name, '$2', split_part(key_params(ite.key_), ',', 2))
+    WHEN (instr(ite.name, '$3') > 0)
+       THEN replace(ite.name, '$3', split_part(key_params(ite.key_), ',', 3))
+    WHEN (instr(ite.name, '$1') > 0) AND (instr(ite.name, '$3') > 0)
+       THEN replace(replace(ite.name, '$1', split_part(key_params(ite.key_), ',', 1)), '$3', split_part(key_params(ite.key_), ',', 3))
+    ELSE ite.name
+  END, ',', ''), ' ', '\ ') 
+-- tags
+|| ',host_name=' || replace(hos.name, ' ', '\ ')
+|| ',group_name=' || replace(grp.name, ' ', '\ ')
+|| ',applications=' || coalesce(replace(replace((SELECT group_concat(app.name || ' ', ',')
+    FROM items_applications iap
+    INNER JOIN applications app on app.applicationid = iap.applicationid
+    WHERE iap.itemid = ite.itemid), ' ', '\ '), ',', ''), 'N.A.')
+|| ' value_min=' || CAST(tre.value_min as text)
+|| ',value_avg=' || CAST(tre.value_avg as text)
+|| ',value_max=' || CAST(tre.value_max as text)
+-- timestamp (in ms)
+|| ' ' || CAST(tre.clock * 1000 as text) as INLINE
+,  CAST(tre.clock * 1000 as text) as clock
+,  tre.itemid
+,  0 as ns
+FROM trends_uint tre
+INNER JOIN items ite on ite.itemid = tre.itemid
+INNER JOIN hosts hos on hos.hostid = ite.hostid
+INNER JOIN hosts_groups hg on hg.hostid = hos.hostid
+INNER JOIN hstgrp grp on grp.groupid = hg.groupid
+WHERE grp.internal=0
+   AND tre.clock >= ##STARTDATE##
+   AND (tre.clock > ##STARTDATE##
+     OR (tre.clock = ##STARTDATE## AND tre.itemid > ##LASTITEMID##))
+   AND tre.clock <= ##ENDDATE##
+ORDER BY tre.clock, tre.itemid
+`
+
+const sqliteHistory string = `SELECT 
+-- measurement
+replace(replace(CASE
+    WHEN (instr(ite.name, '$2') > 0) AND (instr(ite.name, '$4') > 0) 
+      THEN replace(replace(ite.name, '$2', split_part(key_params(ite.key_), ',', 2)), '$4', split_part(key_params(ite.key_), ',', 4))
+    WHEN (instr(ite.name, '$1') > 0) AND (instr(ite.name, '$2') > 0) 
+      THEN replace(replace(ite.name, '$1', split_part(key_params(ite.key_), ',', 1)), '$2', split_part(key_params(ite.key_), ',', 2))
+    WHEN (instr(ite.name, '$1') > 0) 
+       THEN replace(ite.name, '$1', split_part(key_params(ite.key_), ',', 1))
+    WHEN (instr(ite.name, '$2') > 0) 
+       THEN replace(ite.name, '$2', split_part(key_params(ite.key_), ',', 2))
+    WHEN (instr(ite.name, '$3') > 0)
+       THEN replace(ite.name, '$3', split_part(key_params(ite.key_), ',', 3))
+    WHEN (instr(ite.name, '$1') > 0) AND (instr(ite.name, '$3') > 0)
+       THEN replace(replace(ite.name, '$1', split_part(key_params(ite.key_), ',', 1)), '$3', split_part(key_params(ite.key_), ',', 3))
+    ELSE ite.name
+  END, ',', ''), ' ', '\ ') 
+-- tags
+|| ',host_name=' || replace(hos.name, ' ', '\ ')
+|| ',group_name=' || replace(grp.name, ' ', '\ ')
+|| ',applications=' || coalesce(replace(replace((SELECT group_concat(app.name || ' ', ',')
+    FROM items_applications iap
+    INNER JOIN applications app on app.applicationid = iap.applicationid
+    WHERE iap.itemid = ite.itemid), ' ', '\ '), ',', ''), 'N.A.')
+|| ' value=' || CAST(his.value as text)
+-- timestamp (in ms)
+|| ' ' || CAST(his.clock * 1000 + CAST(round(his.ns / 1000000.0) as integer) as text) as INLINE
+,  CAST(his.clock * 1000 as text) as clock
+,  his.itemid
+,  his.ns
+FROM history his
+INNER JOIN items ite on ite.itemid = his.itemid
+INNER JOIN hosts hos on hos.hostid = ite.hostid
+INNER JOIN hosts_groups hg on hg.hostid = hos.hostid
+INNER JOIN hstgrp grp on grp.groupid = hg.groupid
+WHERE grp.internal=0
+   AND his.clock >= ##STARTDATE##
+   AND (his.clock > ##STARTDATE##
+     OR (his.clock = ##STARTDATE## AND his.ns > ##LASTNS##)
+     OR (his.clock = ##STARTDATE## AND his.ns = ##LASTNS## AND his.itemid > ##LASTITEMID##))
+   AND his.clock <= ##ENDDATE##
+ORDER BY his.clock, his.ns, his.itemid
+`
+
+const sqliteHistoryUInt string = `SELECT 
+-- measurement
+replace(replace(CASE
+    WHEN (instr(ite.name, '$2') > 0) AND (instr(ite.name, '$4') > 0) 
+      THEN replace(replace(ite.name, '$2', split_part(key_params(ite.key_), ',', 2)), '$4', split_part(key_params(ite.key_), ',', 4))
+    WHEN (instr(ite.name, '$1') > 0) AND (instr(ite.name, '$2') > 0) 
+      THEN replace(replace(ite.name, '$1', split_part(key_params(ite.key_), ',', 1)), '$2', split_part(key_params(ite.key_), ',', 2))
+    WHEN (instr(ite.name, '$1') > 0) 
+       THEN replace(ite.name, '$1', split_part(key_params(ite.key_), ',', 1))
+    WHEN (instr(ite.name, '$2') > 0) 
+       THEN replace(ite.name, '$2', split_part(key_params(ite.key_), ',', 2))
+    WHEN (instr(ite.name, '$3') > 0)
+       THEN replace(ite.name, '$3', split_part(key_params(ite.key_), ',', 3))
+    WHEN (instr(ite.name, '$1') > 0) AND (instr(ite.name, '$3') > 0)
+       THEN replace(replace(ite.name, '$1', split_part(key_params(ite.key_), ',', 1)), '$3', split_part(key_params(ite.key_), ',', 3))
+    ELSE ite.name
+  END, ',', ''), ' ', '\ ') 
+-- tags
+|| ',host_name=' || replace(hos.name, ' ', '\ ')
+|| ',group_name=' || replace(grp.name, ' ', '\ ')
+|| ',applications=' || coalesce(replace(replace((SELECT group_concat(app.name || ' ', ',')
+    FROM items_applications iap
+    INNER JOIN applications app on app.applicationid = iap.applicationid
+    WHERE iap.itemid = ite.itemid), ' ', '\ '), ',', ''), 'N.A.')
+|| ' value=' || CAST(his.value as text)
+-- timestamp (in ms)
+|| ' ' || CAST(his.clock * 1000 + CAST(round(his.ns / 1000000.0) as integer) as text) as INLINE
+,  CAST(his.clock * 1000 as text) as clock
+,  his.itemid
+,  his.ns
+FROM history_uint his
+INNER JOIN items ite on ite.itemid = his.itemid
+INNER JOIN hosts hos on hos.hostid = ite.hostid
+INNER JOIN hosts_groups hg on hg.hostid = hos.hostid
+INNER JOIN hstgrp grp on grp.groupid = hg.groupid
+WHERE grp.internal=0
+   AND his.clock >= ##STARTDATE##
+   AND (his.clock > ##STARTDATE##
+     OR (his.clock = ##STARTDATE## AND his.ns > ##LASTNS##)
+     OR (his.clock = ##STARTDATE## AND his.ns = ##LASTNS## AND his.itemid > ##LASTITEMID##))
+   AND his.clock <= ##ENDDATE##
+ORDER BY his.clock, his.ns, his.itemid
+`
@@ -0,0 +1,72 @@
+package input
+
+import (
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// Placeholders available in query templates.
+// Rows after the cursor (STARTDATE, LASTNS, LASTITEMID) and up to ENDDATE are read.
+//
+//	##STARTDATE##  clock of the cursor, Unix time in seconds
+//	##LASTNS##     ns of the cursor, 999999999 after all rows of STARTDATE
+//	##LASTITEMID## itemid of the cursor, max int64 after all rows of STARTDATE
+//	##ENDDATE##    window end, Unix time in seconds (included)
+const (
+	StartDatePlaceholder  string = "STARTDATE"
+	EndDatePlaceholder    string = "ENDDATE"
+	LastNsPlaceholder     string = "LASTNS"
+	LastItemIdPlaceholder string = "LASTITEMID"
+)
+
+// Placeholders of the host and group filters of the built-in queries,
+// one per name.
+const (
+	HostNamePlaceholder  string = "HOSTNAME"
+	GroupNamePlaceholder string = "GROUPNAME"
+)
+
+var placeholders = regexp.MustCompile(`##(STARTDATE|ENDDATE|LASTNS|LASTITEMID|HOSTNAME|GROUPNAME)##`)
+
+// readQueryFile loads a SQL template from disk.
+func readQueryFile(filename string) (string, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+	query := strings.TrimSpace(string(content))
+	return strings.TrimRight(query, ";"), nil
+}
+
+// compileQuery turns the placeholders of a template into bind parameters
+// of the given provider and returns the parameter names in bind order.
+func compileQuery(provider Provider, query string) (string, []string) {
+	var params []string
+	compiled := placeholders.ReplaceAllStringFunc(query, func(m string) string {
+		params = append(params, strings.Trim(m, "#"))
+		return provider.BindVar(len(params))
+	})
+	return compiled, params
+}
+
+// filterQuery restricts a built-in query to the hosts and groups of the given names,
+// all when empty.
+func filterQuery(query string, hosts []string, groups []string) string {
+	var filter string
+	if len(hosts) > 0 {
+		filter += "\n   AND hos.name IN (" + repeatPlaceholder(HostNamePlaceholder, len(hosts)) + ")"
+	}
+	if len(groups) > 0 {
+		filter += "\n   AND grp.name IN (" + repeatPlaceholder(GroupNamePlaceholder, len(groups)) + ")"
+	}
+	return strings.Replace(query, "WHERE grp.internal=0", "WHERE grp.internal=0"+filter, 1)
+}
+
+func repeatPlaceholder(name string, n int) string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = "##" + name + "##"
+	}
+	return strings.Join(list, ", ")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"time"
+
+	metrics "github.com/zensqlmonitor/influxdb-zabbix/metrics"
+)
+
+// Metrics of the exporter, served on /metrics of the HTTP listener.
+// The table label is the table or collector name,
+// the output label is influxdb or file.
+var (
+	rowsExtracted = metrics.NewCounterVec(
+		"influxdb_zabbix_rows_extracted_total",
+		"Rows extracted from the Zabbix database.",
+		"table")
+	extractSeconds = metrics.NewHistogramVec(
+		"influxdb_zabbix_extract_duration_seconds",
+		"Duration of the extractions.",
+		metrics.DefaultBuckets,
+		"table")
+	pointsWritten = metrics.NewCounterVec(
+		"influxdb_zabbix_points_written_total",
+		"Points written to the output.",
+		"table", "output")
+	batchesFailed = metrics.NewCounterVec(
+		"influxdb_zabbix_batches_failed_total",
+		"Batches the output failed to write.",
+		"table", "output")
+	loadSeconds = metrics.NewHistogramVec(
+		"influxdb_zabbix_load_duration_seconds",
+		"Duration of the batch writes.",
+		metrics.DefaultBuckets,
+		"table", "output")
+	checkpointLag = metrics.NewGaugeVec(
+		"influxdb_zabbix_checkpoint_lag_seconds",
+		"Seconds between now and the checkpoint of the table.",
+		"table")
+	registrySaveFailures = metrics.NewCounterVec(
+		"influxdb_zabbix_registry_save_failures_total",
+		"Registry saves that failed.")
+)
+
+// observeExtract records an extraction, or a collect, of rows.
+func observeExtract(table string, rows int, duration time.Duration) {
+	rowsExtracted.Add(float64(rows), table)
+	extractSeconds.Observe(duration.Seconds(), table)
+	selfStats.extract(table, rows, duration)
+}
+
+// observeLoad records the write of a batch of points, failed when err is set.
+func observeLoad(table string, output string, points int, duration time.Duration, err error) {
+	loadSeconds.Observe(duration.Seconds(), table, output)
+	if err != nil {
+		batchesFailed.Inc(table, output)
+	} else {
+		pointsWritten.Add(float64(points), table, output)
+	}
+	selfStats.load(table, points, duration, err)
+}
+
+// observeCheckpoint records the checkpoint of a table.
+func observeCheckpoint(table string, checkpoint time.Time) {
+	checkpointLag.SetSince(checkpoint, table)
+	selfStats.checkpoint(table, checkpoint)
+}
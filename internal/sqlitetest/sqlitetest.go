@@ -0,0 +1,46 @@
+//go:build sqlite
+// +build sqlite
+
+// Package sqlitetest builds the sqlite Zabbix databases of the tests.
+package sqlitetest
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// NewDB creates a sqlite Zabbix database with the schema and the sample rows
+// of scripts/sqlite, then runs the statements given. It returns its path.
+func NewDB(t testing.TB, statements ...string) string {
+	t.Helper()
+
+	_, source, _, _ := runtime.Caller(0)
+	scriptsDir := filepath.Join(filepath.Dir(source), "..", "..", "scripts", "sqlite")
+
+	path := filepath.Join(t.TempDir(), "zabbix.db")
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var scripts []string
+	for _, script := range []string{"zabbix-schema.sql", "sample-data.sql"} {
+		data, err := ioutil.ReadFile(filepath.Join(scriptsDir, script))
+		if err != nil {
+			t.Fatal(err)
+		}
+		scripts = append(scripts, string(data))
+	}
+	for _, statement := range append(scripts, statements...) {
+		if _, err := conn.Exec(statement); err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	return path
+}
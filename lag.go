@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	helpers "github.com/zensqlmonitor/influxdb-zabbix/helpers"
+	log "github.com/zensqlmonitor/influxdb-zabbix/log"
+	status "github.com/zensqlmonitor/influxdb-zabbix/status"
+)
+
+// lagCheckInterval is the time between two checks of the table checkpoints.
+const lagCheckInterval time.Duration = 30 * time.Second
+
+// lagHookTimeout bounds a run of the lag hook.
+const lagHookTimeout time.Duration = 30 * time.Second
+
+// watchLag reports the tables whose checkpoint falls behind their max_lag,
+// and the ones catching up, until stopped.
+func watchLag(ctx context.Context) {
+	lagging := make(map[string]bool)
+	ticker := time.NewTicker(lagCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		checkLag(lagging)
+	}
+}
+
+// checkLag logs and runs the lag hook when a table starts or stops lagging.
+func checkLag(lagging map[string]bool) {
+	for _, st := range status.Workers() {
+		if st.Kind != "table" || st.MaxLagSeconds == nil || st.LagSeconds == nil || st.State == status.Stopped {
+			delete(lagging, st.Name)
+			continue
+		}
+		if st.Lagging == lagging[st.Name] {
+			continue
+		}
+		lagging[st.Name] = st.Lagging
+
+		var tableForLog string = helpers.RightPad(st.Name, " ", 12-len(st.Name))
+		var maxLag time.Duration = time.Duration(*st.MaxLagSeconds) * time.Second
+		var lag time.Duration = time.Duration(*st.LagSeconds * float64(time.Second)).Truncate(time.Second)
+		fields := log.Fields{"table": st.Name, "phase": "lag", "lag": lag, "max_lag": maxLag, "checkpoint": *st.Checkpoint}
+		if st.Lagging {
+			msg := fmt.Sprintf("--- Lagging | %s | checkpoint %v is %s behind, more than %s",
+				tableForLog,
+				st.Checkpoint.Format("2006-01-02 15:04:05"),
+				lag,
+				maxLag)
+			if st.LagLevel == "Error" {
+				log.WithFields(fields).Error(1, "%s", msg)
+			} else {
+				log.WithFields(fields).Warn("%s", msg)
+			}
+			runLagHook(st, "lagging")
+		} else {
+			log.WithFields(fields).Info("--- Caught up | %s | checkpoint %v is %s behind",
+				tableForLog,
+				st.Checkpoint.Format("2006-01-02 15:04:05"),
+				lag)
+			runLagHook(st, "recovered")
+		}
+	}
+}
+
+// runLagHook runs the lag_hook command, if configured, in background
+// with the table, its lag and state in its environment.
+func runLagHook(st status.WorkerStatus, state string) {
+
+	hook := currentConfig().Polling.LagHook
+	if len(strings.TrimSpace(hook)) == 0 {
+		return
+	}
+	env := append(os.Environ(),
+		"INFLUXDB_ZABBIX_TABLE="+st.Name,
+		"INFLUXDB_ZABBIX_STATE="+state,
+		"INFLUXDB_ZABBIX_LEVEL="+st.LagLevel,
+		fmt.Sprintf("INFLUXDB_ZABBIX_LAG=%.0f", *st.LagSeconds),
+		fmt.Sprintf("INFLUXDB_ZABBIX_MAX_LAG=%.0f", *st.MaxLagSeconds),
+		"INFLUXDB_ZABBIX_CHECKPOINT="+st.Checkpoint.Format(time.RFC3339))
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), lagHookTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "/bin/sh", "-c", hook)
+		cmd.Env = env
+		if out, err := cmd.CombinedOutput(); err != nil {
+			log.Error(1, "Error while running lag hook for %s. %s %s",
+				st.Name, err, strings.TrimSpace(string(out)))
+		}
+	}()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	cfg "github.com/zensqlmonitor/influxdb-zabbix/config"
+)
+
+// limiter bounds the number of concurrent extractions,
+// overall and per Zabbix source. A nil channel means no limit.
+type limiter struct {
+	global  chan struct{}
+	sources map[string]chan struct{}
+}
+
+// extractions is replaced on reload, extractions running keep
+// the slots they acquired from the previous limiter.
+var extractions = newLimiter(cfg.TOMLConfig{})
+
+var extractionsMu sync.RWMutex
+
+func newLimiter(config cfg.TOMLConfig) *limiter {
+	l := &limiter{sources: make(map[string]chan struct{})}
+	if config.Polling.MaxExtractions > 0 {
+		l.global = make(chan struct{}, config.Polling.MaxExtractions)
+	}
+	for provider, zabbix := range config.Zabbix {
+		if zabbix.MaxExtractions > 0 {
+			l.sources[provider] = make(chan struct{}, zabbix.MaxExtractions)
+		}
+	}
+	return l
+}
+
+// setLimits replaces the limiter from the configuration.
+func setLimits(config cfg.TOMLConfig) {
+	extractionsMu.Lock()
+	extractions = newLimiter(config)
+	extractionsMu.Unlock()
+}
+
+// limit runs f once a slot is free for the source, overall and for the source.
+func limit(ctx context.Context, source string, f func() error) error {
+
+	extractionsMu.RLock()
+	l := extractions
+	extractionsMu.RUnlock()
+
+	// always acquire the source slot first, then the global one
+	for _, slots := range []chan struct{}{l.sources[source], l.global} {
+		if slots == nil {
+			continue
+		}
+		select {
+		case slots <- struct{}{}:
+			defer func(slots chan struct{}) { <-slots }(slots)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return f()
+}
@@ -6,6 +6,8 @@ package log
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"runtime"
@@ -33,15 +35,19 @@ var colors = []Brush{
 
 // ConsoleWriter implements LoggerInterface and writes messages to terminal.
 type ConsoleWriter struct {
-	lg    *log.Logger
-	Level int `json:"level"`
+	lg     *log.Logger
+	out    io.Writer
+	Level  int    `json:"level"`
+	Format string `json:"format"`
 }
 
 // create ConsoleWriter returning as LoggerInterface.
 func NewConsole() LoggerInterface {
 	return &ConsoleWriter{
-		lg:    log.New(os.Stdout, "", log.Ldate|log.Ltime),
-		Level: TRACE,
+		lg:     log.New(os.Stdout, "", log.Ldate|log.Ltime),
+		out:    os.Stdout,
+		Level:  TRACE,
+		Format: TextFormat,
 	}
 }
 
@@ -49,14 +55,18 @@ func (cw *ConsoleWriter) Init(config string) error {
 	return json.Unmarshal([]byte(config), cw)
 }
 
-func (cw *ConsoleWriter) WriteMsg(msg string, skip, level int) error {
-	if cw.Level > level {
+func (cw *ConsoleWriter) WriteMsg(rec *Record) error {
+	if !rec.Enabled(cw.Level) {
 		return nil
 	}
+	if cw.Format == JSONFormat {
+		_, err := fmt.Fprintln(cw.out, formatJSON(rec))
+		return err
+	}
 	if runtime.GOOS == "windows" {
-		cw.lg.Println(msg)
+		cw.lg.Println(rec.Text)
 	} else {
-		cw.lg.Println(colors[level](msg))
+		cw.lg.Println(colors[rec.Level](rec.Text))
 	}
 	return nil
 }
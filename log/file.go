@@ -41,7 +41,8 @@ type FileLogWriter struct {
 
 	startLock sync.Mutex // Only one log can write to the file
 
-	Level int `json:"level"`
+	Level  int    `json:"level"`
+	Format string `json:"format"`
 }
 
 // an *os.File writer with locker.
@@ -75,6 +76,7 @@ func NewFileWriter() LoggerInterface {
 		Maxdays:  7,
 		Rotate:   true,
 		Level:    TRACE,
+		Format:   TextFormat,
 	}
 	// use MuxWriter instead direct use os.File for lock write when rotate
 	w.mw = new(MuxWriter)
@@ -132,13 +134,19 @@ func (w *FileLogWriter) docheck(size int) {
 }
 
 // write logger message into file.
-func (w *FileLogWriter) WriteMsg(msg string, skip, level int) error {
-	if level < w.Level {
+func (w *FileLogWriter) WriteMsg(rec *Record) error {
+	if !rec.Enabled(w.Level) {
 		return nil
 	}
-	n := 24 + len(msg) // 24 stand for the length "2013/06/23 21:00:22 [T] "
+	if w.Format == JSONFormat {
+		line := formatJSON(rec) + "\n"
+		w.docheck(len(line))
+		_, err := w.mw.Write([]byte(line))
+		return err
+	}
+	n := 24 + len(rec.Text) // 24 stand for the length "2013/06/23 21:00:22 [T] "
 	w.docheck(n)
-	w.Logger.Println(msg)
+	w.Logger.Println(rec.Text)
 	return nil
 }
 
@@ -0,0 +1,110 @@
+//go:build !windows
+// +build !windows
+
+package log
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// JournaldSocket is the socket of the native journal protocol.
+const JournaldSocket = "/run/systemd/journal/socket"
+
+// syslog priorities of the levels
+var journaldPriorities = []int{7, 7, 6, 4, 3, 2, 2}
+
+// JournaldWriter implements LoggerInterface and writes messages to the systemd journal
+// with the native protocol: fields are journal fields, e.g. TABLE, PHASE or ROWS.
+type JournaldWriter struct {
+	conn   *net.UnixConn
+	Level  int    `json:"level"`
+	Tag    string `json:"tag"`
+	Socket string `json:"socket"`
+}
+
+// create JournaldWriter returning as LoggerInterface.
+func NewJournald() LoggerInterface {
+	return &JournaldWriter{
+		Level:  TRACE,
+		Socket: JournaldSocket,
+	}
+}
+
+func (jw *JournaldWriter) Init(config string) error {
+	if err := json.Unmarshal([]byte(config), jw); err != nil {
+		return err
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: jw.Socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	jw.conn = conn
+	return nil
+}
+
+func (jw *JournaldWriter) WriteMsg(rec *Record) error {
+	if !rec.Enabled(jw.Level) {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	journalField(&buf, "MESSAGE", rec.Message)
+	journalField(&buf, "PRIORITY", fmt.Sprint(journaldPriorities[rec.Level]))
+	if len(jw.Tag) > 0 {
+		journalField(&buf, "SYSLOG_IDENTIFIER", jw.Tag)
+	}
+	if len(rec.Caller) > 0 {
+		journalField(&buf, "CODE_FUNC", rec.Caller)
+	}
+	for k, v := range rec.Fields {
+		if name := journalName(k); len(name) > 0 {
+			journalField(&buf, name, fmt.Sprint(fieldValue(v)))
+		}
+	}
+
+	_, err := jw.conn.Write(buf.Bytes())
+	return err
+}
+
+// journalField appends a field, values with new lines being sized.
+func journalField(buf *bytes.Buffer, name string, value string) {
+	buf.WriteString(name)
+	if strings.ContainsRune(value, '\n') {
+		buf.WriteByte('\n')
+		binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	} else {
+		buf.WriteByte('=')
+	}
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalName returns the journal name of a field:
+// upper case letters, digits and underscores, not starting with an underscore.
+func journalName(key string) string {
+	name := []byte(strings.ToUpper(key))
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			name[i] = '_'
+		}
+	}
+	return strings.TrimLeft(string(name), "_0123456789")
+}
+
+func (_ *JournaldWriter) Flush() {
+}
+
+func (jw *JournaldWriter) Destroy() {
+	if jw.conn != nil {
+		jw.conn.Close()
+	}
+}
+
+func init() {
+	Register("journald", NewJournald)
+}
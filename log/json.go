@@ -0,0 +1,56 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Formats of the console and file writers.
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+var levelNames = []string{"trace", "debug", "info", "warn", "error", "critical", "fatal"}
+
+// fieldValue returns the value of a field as written:
+// durations in seconds, errors as their message and times as RFC3339.
+func fieldValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case time.Duration:
+		return v.Seconds()
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+// formatJSON returns a record as a line of JSON: time, level, message,
+// caller for errors, and its fields. Durations are written in seconds.
+func formatJSON(rec *Record) string {
+
+	line := make(map[string]interface{}, len(rec.Fields)+4)
+	for k, v := range rec.Fields {
+		line[k] = fieldValue(v)
+	}
+	line["time"] = rec.Time.Format(time.RFC3339Nano)
+	line["level"] = levelNames[rec.Level]
+	line["msg"] = strings.Join(strings.Fields(rec.Message), " ")
+	if len(rec.Caller) > 0 {
+		line["caller"] = rec.Caller
+	}
+
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(line); err != nil {
+		return fmt.Sprintf(`{"time":%q,"level":%q,"msg":%q,"error":%q}`,
+			rec.Time.Format(time.RFC3339Nano), levelNames[rec.Level], rec.Message, err.Error())
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -11,6 +11,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 )
 
 var LogLevels = map[string]int{
@@ -88,6 +89,58 @@ func Fatal(skip int, format string, v ...interface{}) {
 	os.Exit(1)
 }
 
+// Fields are the structured fields of a message, written as such in json format:
+// table, phase (window, extract, load, wait), rows, duration and error.
+type Fields map[string]interface{}
+
+// Entry logs messages with fields.
+type Entry struct {
+	fields Fields
+	level  int
+}
+
+// WithFields returns an entry logging messages with the given fields.
+func WithFields(fields Fields) Entry {
+	return Entry{fields: fields, level: NoLevel}
+}
+
+// WithLevel returns an entry logging messages from the given level,
+// whatever the levels of the writers, e.g. to trace a single table.
+func (e Entry) WithLevel(level int) Entry {
+	e.level = level
+	return e
+}
+
+func (e Entry) Trace(format string, v ...interface{}) {
+	for _, logger := range loggers {
+		logger.writerEntry(0, TRACE, e, fmt.Sprintf(format, v...))
+	}
+}
+
+func (e Entry) Debug(format string, v ...interface{}) {
+	for _, logger := range loggers {
+		logger.writerEntry(0, DEBUG, e, fmt.Sprintf(format, v...))
+	}
+}
+
+func (e Entry) Info(format string, v ...interface{}) {
+	for _, logger := range loggers {
+		logger.writerEntry(0, INFO, e, fmt.Sprintf(format, v...))
+	}
+}
+
+func (e Entry) Warn(format string, v ...interface{}) {
+	for _, logger := range loggers {
+		logger.writerEntry(0, WARN, e, fmt.Sprintf(format, v...))
+	}
+}
+
+func (e Entry) Error(skip int, format string, v ...interface{}) {
+	for _, logger := range loggers {
+		logger.writerEntry(skip+1, ERROR, e, fmt.Sprintf(format, v...))
+	}
+}
+
 func Close() {
 	for _, l := range loggers {
 		l.Close()
@@ -113,10 +166,36 @@ const (
 	FATAL
 )
 
+// prefixes of the messages by level, in text format.
+var prefixes = []string{"[T] ", "[D] ", "[I] ", "[W] ", "[E] ", "[C] ", "[F] "}
+
+// NoLevel is the level override of a record written at the level of the writers.
+const NoLevel = -1
+
+// Record is a message to write.
+type Record struct {
+	Time     time.Time
+	Level    int
+	Override int // level from which the record is written whatever the writer level, or NoLevel
+	Skip     int
+	Text     string // message in text format: level prefix, caller for errors
+	Message  string
+	Caller   string // file, line and function, for errors
+	Fields   Fields
+}
+
+// Enabled reports whether a writer at the given level writes the record.
+func (r *Record) Enabled(level int) bool {
+	if r.Override != NoLevel {
+		return r.Level >= r.Override
+	}
+	return r.Level >= level
+}
+
 // LoggerInterface represents behaviors of a logger provider.
 type LoggerInterface interface {
 	Init(config string) error
-	WriteMsg(msg string, skip, level int) error
+	WriteMsg(rec *Record) error
 	Destroy()
 	Flush()
 }
@@ -136,18 +215,13 @@ func Register(name string, log loggerType) {
 	adapters[name] = log
 }
 
-type logMsg struct {
-	skip, level int
-	msg         string
-}
-
 // Logger is default logger in beego application.
 // it can contain several providers and log message into all providers.
 type Logger struct {
 	adapter string
 	lock    sync.Mutex
 	level   int
-	msg     chan *logMsg
+	msg     chan *Record
 	outputs map[string]LoggerInterface
 	quit    chan bool
 }
@@ -155,7 +229,7 @@ type Logger struct {
 // newLogger initializes and returns a new logger.
 func newLogger(buffer int64) *Logger {
 	l := &Logger{
-		msg:     make(chan *logMsg, buffer),
+		msg:     make(chan *Record, buffer),
 		outputs: make(map[string]LoggerInterface),
 		quit:    make(chan bool),
 	}
@@ -193,17 +267,27 @@ func (l *Logger) DelLogger(adapter string) error {
 	return nil
 }
 
-func (l *Logger) writerMsg(skip, level int, msg string) error {
-	if l.level > level {
+func (l *Logger) writerMsg(skip, level int, fields Fields, message string) error {
+	return l.writerEntry(skip+1, level, Entry{fields: fields, level: NoLevel}, message)
+}
+
+func (l *Logger) writerEntry(skip, level int, e Entry, message string) error {
+	if l.level > level && e.level == NoLevel {
 		return nil
 	}
-	lm := &logMsg{
-		skip:  skip,
-		level: level,
+	message = mask(message)
+	lm := &Record{
+		Time:     time.Now(),
+		Skip:     skip,
+		Level:    level,
+		Override: e.level,
+		Message:  message,
+		Fields:   maskFields(e.fields),
 	}
+	msg := prefixes[level] + message
 
 	// Only error information needs locate position for debugging.
-	if lm.level >= ERROR {
+	if lm.Level >= ERROR {
 		pc, file, line, ok := runtime.Caller(skip)
 		if ok {
 			// Get caller function name.
@@ -219,12 +303,13 @@ func (l *Logger) writerMsg(skip, level int, msg string) error {
 			if len(fileName) > 20 {
 				fileName = "..." + fileName[len(fileName)-20:]
 			}
-			lm.msg = fmt.Sprintf("[%s:%d %s] %s", fileName, line, fnName, msg)
+			lm.Caller = fmt.Sprintf("%s:%d %s", fileName, line, fnName)
+			lm.Text = fmt.Sprintf("[%s] %s", lm.Caller, msg)
 		} else {
-			lm.msg = msg
+			lm.Text = msg
 		}
 	} else {
-		lm.msg = msg
+		lm.Text = msg
 	}
 	l.msg <- lm
 	return nil
@@ -236,7 +321,7 @@ func (l *Logger) StartLogger() {
 		select {
 		case bm := <-l.msg:
 			for _, l := range l.outputs {
-				if err := l.WriteMsg(bm.msg, bm.skip, bm.level); err != nil {
+				if err := l.WriteMsg(bm); err != nil {
 					fmt.Println("ERROR, unable to WriteMsg:", err)
 				}
 			}
@@ -260,7 +345,7 @@ func (l *Logger) Close() {
 		if len(l.msg) > 0 {
 			bm := <-l.msg
 			for _, l := range l.outputs {
-				if err := l.WriteMsg(bm.msg, bm.skip, bm.level); err != nil {
+				if err := l.WriteMsg(bm); err != nil {
 					fmt.Println("ERROR, unable to WriteMsg:", err)
 				}
 			}
@@ -275,38 +360,31 @@ func (l *Logger) Close() {
 }
 
 func (l *Logger) Trace(format string, v ...interface{}) {
-	msg := fmt.Sprintf("[T] "+format, v...)
-	l.writerMsg(0, TRACE, msg)
+	l.writerMsg(0, TRACE, nil, fmt.Sprintf(format, v...))
 }
 
 func (l *Logger) Debug(format string, v ...interface{}) {
-	msg := fmt.Sprintf("[D] "+format, v...)
-	l.writerMsg(0, DEBUG, msg)
+	l.writerMsg(0, DEBUG, nil, fmt.Sprintf(format, v...))
 }
 
 func (l *Logger) Info(format string, v ...interface{}) {
-	msg := fmt.Sprintf("[I] "+format, v...)
-	l.writerMsg(0, INFO, msg)
+	l.writerMsg(0, INFO, nil, fmt.Sprintf(format, v...))
 }
 
 func (l *Logger) Warn(format string, v ...interface{}) {
-	msg := fmt.Sprintf("[W] "+format, v...)
-	l.writerMsg(0, WARN, msg)
+	l.writerMsg(0, WARN, nil, fmt.Sprintf(format, v...))
 }
 
 func (l *Logger) Error(skip int, format string, v ...interface{}) {
-	msg := fmt.Sprintf("[E] "+format, v...)
-	l.writerMsg(skip, ERROR, msg)
+	l.writerMsg(skip, ERROR, nil, fmt.Sprintf(format, v...))
 }
 
 func (l *Logger) Critical(skip int, format string, v ...interface{}) {
-	msg := fmt.Sprintf("[C] "+format, v...)
-	l.writerMsg(skip, CRITICAL, msg)
+	l.writerMsg(skip, CRITICAL, nil, fmt.Sprintf(format, v...))
 }
 
 func (l *Logger) Fatal(skip int, format string, v ...interface{}) {
-	msg := fmt.Sprintf("[F] "+format, v...)
-	l.writerMsg(skip, FATAL, msg)
+	l.writerMsg(skip, FATAL, nil, fmt.Sprintf(format, v...))
 	l.Close()
 	os.Exit(1)
 }
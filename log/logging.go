@@ -21,9 +21,14 @@ func Init(config cfg.TOMLConfig) {
 
 		// Log Level
 		var levelName string
-		if mode == "console" {
+		switch mode {
+		case "console":
 			levelName = config.Logging.LevelConsole
-		} else {
+		case "syslog":
+			levelName = config.Logging.LevelSyslog
+		case "journald":
+			levelName = config.Logging.LevelJournald
+		default:
 			levelName = config.Logging.LevelFile
 		}
 
@@ -34,18 +39,32 @@ func Init(config cfg.TOMLConfig) {
 		// Generate log configuration
 		switch mode {
 		case "console":
-			LogConfigs[i] = fmt.Sprintf(`{"level":%v,"formatting":%v}`,
+			LogConfigs[i] = fmt.Sprintf(`{"level":%v,"formatting":%v,"format":"%s"}`,
 				level,
-				config.Logging.Formatting)
+				config.Logging.Formatting,
+				config.Logging.Format)
 		case "file":
-			LogConfigs[i] = fmt.Sprintf(`{"level":%v,"filename":"%s","rotate":%v,"maxlines":%d,"maxsize":%d,"daily":%v,"maxdays":%d}`,
+			LogConfigs[i] = fmt.Sprintf(`{"level":%v,"format":"%s","filename":"%s","rotate":%v,"maxlines":%d,"maxsize":%d,"daily":%v,"maxdays":%d}`,
 				level,
+				config.Logging.Format,
 				config.Logging.FileName,
 				config.Logging.LogRotate,
 				config.Logging.MaxLines,
 				1<<uint(config.Logging.MaxSizeShift),
 				config.Logging.DailyRotate,
 				config.Logging.MaxDays)
+		case "syslog":
+			LogConfigs[i] = fmt.Sprintf(`{"level":%v,"format":"%s","network":"%s","address":"%s","facility":"%s","tag":"%s"}`,
+				level,
+				config.Logging.Format,
+				config.Logging.SyslogNetwork,
+				config.Logging.SyslogAddress,
+				config.Logging.SyslogFacility,
+				config.Logging.Tag)
+		case "journald":
+			LogConfigs[i] = fmt.Sprintf(`{"level":%v,"tag":"%s"}`,
+				level,
+				config.Logging.Tag)
 		}
 		NewLogger(int64(config.Logging.BufferLen), mode, LogConfigs[i])
 		Trace("Log Mode: %s(%s)", strings.Title(mode), levelName)
@@ -0,0 +1,37 @@
+package log
+
+import (
+	"errors"
+
+	cfg "github.com/zensqlmonitor/influxdb-zabbix/config"
+)
+
+// mask returns s with the passwords of its DSNs and URLs masked.
+func mask(s string) string {
+	return cfg.MaskPasswords(s)
+}
+
+// Masked returns s with its passwords masked,
+// for output that does not go through the loggers.
+func Masked(s string) string {
+	return mask(s)
+}
+
+// maskFields returns the fields with the passwords of their strings and errors masked.
+func maskFields(fields Fields) Fields {
+	if len(fields) == 0 {
+		return fields
+	}
+	masked := make(Fields, len(fields))
+	for k, v := range fields {
+		switch v := v.(type) {
+		case string:
+			masked[k] = mask(v)
+		case error:
+			masked[k] = errors.New(mask(v.Error()))
+		default:
+			masked[k] = v
+		}
+	}
+	return masked
+}
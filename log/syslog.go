@@ -0,0 +1,118 @@
+//go:build !windows
+// +build !windows
+
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"strings"
+)
+
+var facilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// SyslogWriter implements LoggerInterface and writes messages to syslog,
+// on the local socket or to a remote server over UDP or TCP.
+type SyslogWriter struct {
+	w        *syslog.Writer
+	Level    int    `json:"level"`
+	Format   string `json:"format"`
+	Network  string `json:"network"` // empty for the local socket, udp or tcp
+	Address  string `json:"address"` // host:port, for udp or tcp
+	Facility string `json:"facility"`
+	Tag      string `json:"tag"`
+}
+
+// create SyslogWriter returning as LoggerInterface.
+func NewSyslog() LoggerInterface {
+	return &SyslogWriter{
+		Level:    TRACE,
+		Format:   TextFormat,
+		Facility: "daemon",
+	}
+}
+
+// Init syslog logger with json config.
+// config like:
+//
+//	{
+//	"network":"udp",
+//	"address":"localhost:514",
+//	"facility":"local0",
+//	"tag":"influxdb-zabbix"
+//	}
+func (sw *SyslogWriter) Init(config string) error {
+	if err := json.Unmarshal([]byte(config), sw); err != nil {
+		return err
+	}
+	facility, ok := facilities[strings.ToLower(sw.Facility)]
+	if !ok {
+		return fmt.Errorf("unknown syslog facility %q", sw.Facility)
+	}
+	w, err := syslog.Dial(sw.Network, sw.Address, facility, sw.Tag)
+	if err != nil {
+		return err
+	}
+	sw.w = w
+	return nil
+}
+
+func (sw *SyslogWriter) WriteMsg(rec *Record) error {
+	if !rec.Enabled(sw.Level) {
+		return nil
+	}
+	msg := rec.Message
+	if sw.Format == JSONFormat {
+		msg = formatJSON(rec)
+	} else if len(rec.Caller) > 0 {
+		msg = fmt.Sprintf("[%s] %s", rec.Caller, msg)
+	}
+
+	switch rec.Level {
+	case TRACE, DEBUG:
+		return sw.w.Debug(msg)
+	case INFO:
+		return sw.w.Info(msg)
+	case WARN:
+		return sw.w.Warning(msg)
+	case ERROR:
+		return sw.w.Err(msg)
+	default:
+		return sw.w.Crit(msg)
+	}
+}
+
+func (_ *SyslogWriter) Flush() {
+}
+
+func (sw *SyslogWriter) Destroy() {
+	if sw.w != nil {
+		sw.w.Close()
+	}
+}
+
+func init() {
+	Register("syslog", NewSyslog)
+}
@@ -0,0 +1,300 @@
+// Package metrics exposes counters, gauges and histograms
+// in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the duration histograms.
+var DefaultBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	mu      sync.Mutex
+	metrics []metric
+)
+
+func register(m metric) {
+	mu.Lock()
+	metrics = append(metrics, m)
+	mu.Unlock()
+}
+
+// vec holds the series of a metric by label values.
+type vec struct {
+	mu     sync.Mutex
+	name   string
+	help   string
+	typ    string
+	labels []string
+}
+
+func (v *vec) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.typ)
+}
+
+// key joins label values, in the order of the label names.
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// format returns the labels of a series, with extra name and value pairs.
+func (v *vec) format(key string, extra ...string) string {
+	var pairs []string
+	if len(v.labels) > 0 {
+		for i, value := range strings.Split(key, "\xff") {
+			pairs = append(pairs, v.labels[i]+`="`+escape(value)+`"`)
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escape(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// CounterVec is a counter by label values.
+type CounterVec struct {
+	vec
+	values map[string]float64
+}
+
+// NewCounterVec returns a registered counter.
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		vec:    vec{name: name, help: help, typ: "counter", labels: labels},
+		values: make(map[string]float64)}
+	if len(labels) == 0 {
+		c.values[""] = 0
+	}
+	register(c)
+	return c
+}
+
+// Add adds v to the counter of the label values.
+func (c *CounterVec) Add(v float64, values ...string) {
+	key := c.key(values)
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// Inc adds one to the counter of the label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.header(w)
+	keys := make(map[string]bool, len(c.values))
+	for k := range c.values {
+		keys[k] = true
+	}
+	for _, k := range sortedKeys(keys) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.format(k), formatFloat(c.values[k]))
+	}
+}
+
+// GaugeVec is a gauge by label values.
+// A gauge set with SetSince is the time elapsed since, at scrape.
+type GaugeVec struct {
+	vec
+	values map[string]float64
+	since  map[string]time.Time
+}
+
+// NewGaugeVec returns a registered gauge.
+func NewGaugeVec(name string, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{
+		vec:    vec{name: name, help: help, typ: "gauge", labels: labels},
+		values: make(map[string]float64),
+		since:  make(map[string]time.Time)}
+	register(g)
+	return g
+}
+
+// Set sets the gauge of the label values.
+func (g *GaugeVec) Set(v float64, values ...string) {
+	key := g.key(values)
+	g.mu.Lock()
+	g.values[key] = v
+	delete(g.since, key)
+	g.mu.Unlock()
+}
+
+// SetSince sets the gauge of the label values to the seconds elapsed since t.
+func (g *GaugeVec) SetSince(t time.Time, values ...string) {
+	key := g.key(values)
+	g.mu.Lock()
+	g.since[key] = t
+	delete(g.values, key)
+	g.mu.Unlock()
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.header(w)
+	keys := make(map[string]bool, len(g.values)+len(g.since))
+	for k := range g.values {
+		keys[k] = true
+	}
+	for k := range g.since {
+		keys[k] = true
+	}
+	for _, k := range sortedKeys(keys) {
+		v, ok := g.values[k]
+		if !ok {
+			v = time.Since(g.since[k]).Seconds()
+		}
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.format(k), formatFloat(v))
+	}
+}
+
+// HistogramVec is a histogram by label values.
+type HistogramVec struct {
+	vec
+	buckets []float64
+	series  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // by bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// NewHistogramVec returns a registered histogram with the given bucket upper bounds.
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		vec:     vec{name: name, help: help, typ: "histogram", labels: labels},
+		buckets: buckets,
+		series:  make(map[string]*histogram)}
+	register(h)
+	return h
+}
+
+// Observe adds a value to the histogram of the label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w)
+	keys := make(map[string]bool, len(h.series))
+	for k := range h.series {
+		keys[k] = true
+	}
+	for _, k := range sortedKeys(keys) {
+		s := h.series[k]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.format(k, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.format(k, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.format(k), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.format(k), s.count)
+	}
+}
+
+// writeRuntime writes the memory stats of the process.
+func writeRuntime(w io.Writer) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	gauge := func(name string, help string, v float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatFloat(v))
+	}
+	counter := func(name string, help string, v float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %s\n", name, help, name, name, formatFloat(v))
+	}
+	gauge("go_goroutines", "Number of goroutines.", float64(runtime.NumGoroutine()))
+	gauge("go_memstats_alloc_bytes", "Bytes of allocated heap objects.", float64(m.Alloc))
+	counter("go_memstats_alloc_bytes_total", "Cumulative bytes allocated for heap objects.", float64(m.TotalAlloc))
+	gauge("go_memstats_sys_bytes", "Bytes of memory obtained from the OS.", float64(m.Sys))
+	gauge("go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.", float64(m.HeapInuse))
+	counter("go_memstats_gc_completed_total", "Number of completed GC cycles.", float64(m.NumGC))
+}
+
+// Handler serves the registered metrics and the memory stats.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		mu.Lock()
+		list := append([]metric(nil), metrics...)
+		mu.Unlock()
+
+		for _, m := range list {
+			m.write(w)
+		}
+		writeRuntime(w)
+	})
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Exposition of a counter, a gauge and a histogram,
+// label values with quotes, backslashes and new lines escaped.
+func TestWrite(t *testing.T) {
+
+	counter := NewCounterVec("test_rows_total", "Rows read.", "table")
+	counter.Add(3, `his"tory`)
+	counter.Inc(`C:\zabbix`)
+
+	gauge := NewGaugeVec("test_lag_seconds", "Lag of the table.", "table", "provider")
+	gauge.Set(1.5, "trends", "line\nbreak")
+	gauge.Set(-2, "history", "mysql")
+
+	histogram := NewHistogramVec("test_duration_seconds", "Duration of the extractions.", []float64{0.1, 1, 10}, "table")
+	histogram.Observe(0.05, "history")
+	histogram.Observe(0.5, "history")
+	histogram.Observe(0.1, "history")
+	histogram.Observe(30, "history")
+
+	var buf bytes.Buffer
+	counter.write(&buf)
+	gauge.write(&buf)
+	histogram.write(&buf)
+
+	golden := `# HELP test_rows_total Rows read.
+# TYPE test_rows_total counter
+test_rows_total{table="C:\\zabbix"} 1
+test_rows_total{table="his\"tory"} 3
+# HELP test_lag_seconds Lag of the table.
+# TYPE test_lag_seconds gauge
+test_lag_seconds{table="history",provider="mysql"} -2
+test_lag_seconds{table="trends",provider="line\nbreak"} 1.5
+# HELP test_duration_seconds Duration of the extractions.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{table="history",le="0.1"} 2
+test_duration_seconds_bucket{table="history",le="1"} 3
+test_duration_seconds_bucket{table="history",le="10"} 3
+test_duration_seconds_bucket{table="history",le="+Inf"} 4
+test_duration_seconds_sum{table="history"} 30.65
+test_duration_seconds_count{table="history"} 4
+`
+	if buf.String() != golden {
+		t.Errorf("exposition:\n%s\nwant:\n%s", buf.String(), golden)
+	}
+}
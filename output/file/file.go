@@ -0,0 +1,123 @@
+// Package file writes line protocol batches to stdout or to rotating files.
+package file
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Writer writes the batches of all tables to the same output,
+// each batch preceded by a comment line with its name, position and row count.
+// Comment lines are ignored by InfluxDB, so that the files can be loaded as is.
+type Writer struct {
+	mu       sync.Mutex
+	filename string
+	maxsize  int64
+	maxfiles int
+
+	out  io.Writer
+	fd   *os.File
+	size int64
+}
+
+// NewWriter returns a Writer to filename, or to stdout when filename is empty or "-".
+// The file is rotated when it exceeds maxsize bytes, keeping maxfiles rotated files:
+// filename.1 is the most recent one.
+func NewWriter(filename string, maxsize int64, maxfiles int) (*Writer, error) {
+	w := &Writer{
+		filename: filename,
+		maxsize:  maxsize,
+		maxfiles: maxfiles}
+
+	if len(filename) == 0 || filename == "-" {
+		w.out = os.Stdout
+		return w, nil
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write writes batch number of batches of a table.
+func (w *Writer) Write(name string, batch int, batches int, lines []string) error {
+
+	data := fmt.Sprintf("# batch %s %d/%d | %d rows | %s\n%s\n",
+		name,
+		batch,
+		batches,
+		len(lines),
+		time.Now().Format(time.RFC3339),
+		strings.Join(lines, "\n"))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.fd != nil && w.maxsize > 0 && w.size > 0 && w.size+int64(len(data)) > w.maxsize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := io.WriteString(w.out, data)
+	w.size += int64(n)
+	return err
+}
+
+// Close closes the current file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.fd == nil {
+		return nil
+	}
+	err := w.fd.Close()
+	w.fd = nil
+	w.out = nil
+	return err
+}
+
+func (w *Writer) open() error {
+	fd, err := os.OpenFile(w.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+	w.fd = fd
+	w.out = fd
+	w.size = info.Size()
+	return nil
+}
+
+// rotate shifts filename.n to filename.n+1, dropping the oldest one,
+// then moves the current file to filename.1 and opens a new one.
+func (w *Writer) rotate() error {
+
+	if err := w.fd.Close(); err != nil {
+		return err
+	}
+	w.fd = nil
+
+	if w.maxfiles > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", w.filename, w.maxfiles))
+		for i := w.maxfiles - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", w.filename, i), fmt.Sprintf("%s.%d", w.filename, i+1))
+		}
+		if err := os.Rename(w.filename, w.filename+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(w.filename); err != nil {
+		return err
+	}
+
+	return w.open()
+}
@@ -2,6 +2,7 @@ package influxdb
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io/ioutil"
 	"net/http"
@@ -9,7 +10,7 @@ import (
 )
 
 type Loader interface {
-	Load() error
+	Load(ctx context.Context) error
 }
 
 type loader struct {
@@ -36,10 +37,14 @@ func NewLoader(url, user, pass, inlinedata string) loader {
 //      If it's HTTP 200 OK, InfluxDB understood the request but couldn't complete it.
 // 4xx: InfluxDB could not understand the request.
 // 5xx: The system is overloaded or significantly impaired
-func (loa *loader) Load() error {
+func (loa *loader) Load(ctx context.Context) error {
 
 	client := &http.Client{}
 	req, err := http.NewRequest("POST", loa.url, bytes.NewBufferString(loa.inlinedata))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
 	req.Header.Set("Content-Type", "application/text")
 	if len(loa.username) > 0 {
 		req.SetBasicAuth(loa.username, loa.password)
@@ -71,3 +76,26 @@ func (loa *loader) Load() error {
 	return nil
 
 }
+
+// Ping checks InfluxDB can be reached, url being the base url of its api.
+func Ping(ctx context.Context, url, user, pass string) error {
+
+	req, err := http.NewRequest("GET", strings.TrimRight(url, "/")+"/ping", nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if len(user) > 0 {
+		req.SetBasicAuth(user, pass)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return errors.New("ping returned " + resp.Status)
+	}
+	return nil
+}
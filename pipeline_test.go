@@ -0,0 +1,284 @@
+//go:build sqlite
+// +build sqlite
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	toml "github.com/BurntSushi/toml"
+	cfg "github.com/zensqlmonitor/influxdb-zabbix/config"
+	input "github.com/zensqlmonitor/influxdb-zabbix/input"
+	sqlitetest "github.com/zensqlmonitor/influxdb-zabbix/internal/sqlitetest"
+	file "github.com/zensqlmonitor/influxdb-zabbix/output/file"
+	registry "github.com/zensqlmonitor/influxdb-zabbix/reg"
+	status "github.com/zensqlmonitor/influxdb-zabbix/status"
+)
+
+// newTestParam returns the worker of a table of the sqlite database db,
+// in windows of one hour from startdate, written to a file.
+// The registry and the output file are in a temporary directory.
+func newTestParam(t *testing.T, db string, table string, startdate string) *Param {
+	t.Helper()
+
+	dir := t.TempDir()
+	config = cfg.TOMLConfig{}
+	config.Registry.FileName = filepath.Join(dir, "registry.json")
+	config.Tables = map[string]*cfg.Table{
+		table: {Name: table, Active: true, Startdate: startdate}}
+	mapTables = make(registry.MapTable)
+	if err := initRegistry(config); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := file.NewWriter(filepath.Join(dir, "output.txt"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+
+	p := &Param{
+		input: Input{
+			provider:      "sqlite",
+			address:       db,
+			tablename:     table,
+			startdate:     startdate,
+			interval:      15,
+			hoursperbatch: 1},
+		output: Output{
+			outputrowsperbatch: cfg.DefaultOutputRowsPerBatch,
+			file:               w}}
+	p.state = status.Register("table", table)
+
+	ext := input.NewExtracter("sqlite", db, table, "", 0)
+	if err := ext.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ext.Close() })
+	p.ext = &ext
+	return p
+}
+
+// outputLines returns the line protocol written by a test worker, without batch comments.
+func outputLines(t *testing.T) []string {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join(filepath.Dir(config.Registry.FileName), "output.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if len(line) > 0 && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestPipelineSQLite(t *testing.T) {
+
+	tests := []struct {
+		table string
+		lines []string
+	}{
+		{"history", []string{
+			`Processor\ load\ (1\ min\ average\ per\ core),host_name=Zabbix\ server,group_name=Zabbix\ servers,applications=CPU\  value=0.15 1483228830120`,
+			`Processor\ load\ (1\ min\ average\ per\ core),host_name=Zabbix\ server,group_name=Zabbix\ servers,applications=CPU\  value=0.2 1483228860000`,
+			`Processor\ load\ (1\ min\ average\ per\ core),host_name=Zabbix\ server,group_name=Zabbix\ servers,applications=CPU\  value=0.05 1483228890500`,
+		}},
+		{"history_uint", []string{
+			`Free\ disk\ space\ on\ /,host_name=Zabbix\ server,group_name=Zabbix\ servers,applications=Filesystems\  value=21474836480 1483228830000`,
+			`Free\ disk\ space\ on\ /,host_name=Zabbix\ server,group_name=Zabbix\ servers,applications=Filesystems\  value=21474832384 1483228890000`,
+		}},
+		{"trends", []string{
+			`Processor\ load\ (1\ min\ average\ per\ core),host_name=Zabbix\ server,group_name=Zabbix\ servers,applications=CPU\  value_min=0.05,value_avg=0.13,value_max=0.2 1483228800000`,
+		}},
+	}
+
+	db := sqlitetest.NewDB(t)
+	for _, tt := range tests {
+		t.Run(tt.table, func(t *testing.T) {
+			p := newTestParam(t, db, tt.table, "2016-12-31T23:59:59")
+			if err := p.gatherData(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			lines := outputLines(t)
+			if strings.Join(lines, "\n") != strings.Join(tt.lines, "\n") {
+				t.Errorf("output:\n%s\nwant:\n%s", strings.Join(lines, "\n"), strings.Join(tt.lines, "\n"))
+			}
+
+			// the window is over: the checkpoint is its end
+			checkpoint := registry.GetValueFromKey(mapTables, tt.table)
+			want := input.Before(1483228799 + 3600)
+			if checkpoint.Cursor == nil || input.Cursor(*checkpoint.Cursor) != want {
+				t.Errorf("checkpoint %+v, want %+v", checkpoint.Cursor, want)
+			}
+		})
+	}
+}
+
+func TestDryRunRegistry(t *testing.T) {
+
+	*dryRun = true
+	defer func() { *dryRun = false }()
+
+	db := sqlitetest.NewDB(t)
+	p := newTestParam(t, db, "history", "2016-12-31T23:59:59")
+	if err := p.gatherData(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(outputLines(t)) != 3 {
+		t.Errorf("%d lines written, want 3", len(outputLines(t)))
+	}
+	if _, err := os.Stat(config.Registry.FileName); !os.IsNotExist(err) {
+		t.Errorf("registry file written in dry-run mode (%v)", err)
+	}
+}
+
+// The overlap re-reads rows before the checkpoint, without moving it back.
+func TestOverlapKeepsCursor(t *testing.T) {
+
+	now := time.Now().Unix()
+	db := sqlitetest.NewDB(t, fmt.Sprintf(`INSERT INTO history (itemid, clock, value, ns) VALUES
+		(23252, %d, 1, 0),
+		(23252, %d, 2, 0)`, now-100, now-50))
+	p := newTestParam(t, db, "history", "")
+	p.input.overlap = 300
+
+	// the window ends after now: the checkpoint is not moved to its end
+	checkpoint := input.Before(now - 20)
+	saveTestCheckpoint(t, "history", checkpoint)
+
+	if err := p.gatherData(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(outputLines(t)) != 2 {
+		t.Errorf("%d lines written, want the 2 rows of the overlap", len(outputLines(t)))
+	}
+	got := registry.GetValueFromKey(mapTables, "history")
+	if got.Cursor == nil || input.Cursor(*got.Cursor) != checkpoint {
+		t.Errorf("checkpoint %+v, want %+v", got.Cursor, checkpoint)
+	}
+
+	// rows read again do not count in the rows per hour sizing catch-up windows
+	if p.ext.Reread != 2 || p.rate != 0 {
+		t.Errorf("%d rows read again, %v rows per hour, want 2 and 0", p.ext.Reread, p.rate)
+	}
+}
+
+// Polling resumes after the cursor saved in registry, within a clock.
+func TestResumeFromRegistry(t *testing.T) {
+
+	db := sqlitetest.NewDB(t, `INSERT INTO history (itemid, clock, value, ns) VALUES
+		(23252, 1483228900, 1.5, 0),
+		(23662, 1483228900, 2.5, 0),
+		(23252, 1483228900, 3.5, 7)`)
+	p := newTestParam(t, db, "history", "2016-12-31T23:59:59")
+	saveTestCheckpoint(t, "history", input.Cursor{Clock: 1483228900, Ns: 0, Itemid: 23252})
+
+	if err := p.gatherData(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	lines := outputLines(t)
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], " 1483228900000") || !strings.HasSuffix(lines[1], " 1483228900000") {
+		t.Fatalf("output:\n%s\nwant the 2 rows after the cursor", strings.Join(lines, "\n"))
+	}
+	if !strings.Contains(lines[0], "value=2.5 ") || !strings.Contains(lines[1], "value=3.5 ") {
+		t.Errorf("output:\n%s\nwant values 2.5 and 3.5", strings.Join(lines, "\n"))
+	}
+}
+
+// saveTestCheckpoint saves the cursor of a table in the registry of the test worker.
+func saveTestCheckpoint(t *testing.T, table string, cursor input.Cursor) {
+	t.Helper()
+
+	startdates := map[string]string{table: time.Unix(cursor.Clock, 0).UTC().Format(cfg.StartdateLayout)}
+	if err := registry.Create(&config, startdates); err != nil {
+		t.Fatal(err)
+	}
+	regCursor := registry.Cursor(cursor)
+	checkpoint := registry.Checkpoint{
+		Startdate: time.Unix(cursor.Clock, 0).Format(time.RFC3339),
+		Cursor:    &regCursor}
+	if err := registry.Save(config, table, checkpoint); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Symbolic startdates of the tables new to the registry are resolved once,
+// those of inactive tables when activated.
+func TestResolveStartdates(t *testing.T) {
+
+	db := sqlitetest.NewDB(t)
+	newConfig := func(address string) cfg.TOMLConfig {
+		data := fmt.Sprintf(`[registry]
+filename = %q
+[zabbix.sqlite]
+address = %q
+[tables.history]
+name = "history"
+active = true
+startdate = "earliest"
+[tables.trends]
+name = "trends"
+active = true
+startdate = "-1h"
+[tables.history_uint]
+name = "history_uint"
+active = false
+startdate = "earliest"
+[tables.trends_uint]
+name = "trends_uint"
+active = false
+startdate = "2017-01-01T00:00:00"
+`, filepath.Join(t.TempDir(), "registry.json"), address)
+		var c cfg.TOMLConfig
+		if _, err := toml.Decode(data, &c); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	config = newConfig(db)
+	mapTables = make(registry.MapTable)
+	before := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	if err := initRegistry(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := registry.GetValueFromKey(mapTables, "history").Startdate; got != "2017-01-01T00:00:29" {
+		t.Errorf("earliest resolved to %q, want the second before the oldest row", got)
+	}
+	trends, err := time.Parse(cfg.StartdateLayout, registry.GetValueFromKey(mapTables, "trends").Startdate)
+	if err != nil || trends.Before(before) || trends.After(before.Add(time.Minute)) {
+		t.Errorf("-1h resolved to %v (%v)", trends, err)
+	}
+	if got := registry.GetValueFromKey(mapTables, "history_uint").Startdate; got != "" {
+		t.Errorf("inactive earliest resolved to %q", got)
+	}
+	if got := registry.GetValueFromKey(mapTables, "trends_uint").Startdate; got != "2017-01-01T00:00:00" {
+		t.Errorf("inactive absolute startdate %q", got)
+	}
+
+	// tables in registry are not resolved again: the database is not read
+	config.Zabbix["sqlite"].Address = filepath.Join(t.TempDir(), "missing", "zabbix.db")
+	if err := initRegistry(config); err != nil {
+		t.Fatal(err)
+	}
+
+	// activated, its startdate cannot be resolved
+	config.Tables["history_uint"].Active = true
+	if err := initRegistry(config); err == nil {
+		t.Error("history_uint activated without its database, want an error")
+	}
+}
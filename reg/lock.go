@@ -0,0 +1,27 @@
+//go:build !windows
+// +build !windows
+
+package registry
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile locks the registry file across processes, e.g. the daemon and
+// a backfill, for a read-modify-write. The lock is taken on a file of its own,
+// the registry file being replaced by each write.
+func lockFile(fileName string) (func(), error) {
+	f, err := os.OpenFile(fileName+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
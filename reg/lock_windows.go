@@ -0,0 +1,7 @@
+package registry
+
+// lockFile does not lock across processes on Windows:
+// the daemon and a backfill must not share a registry file.
+func lockFile(fileName string) (func(), error) {
+	return func() {}, nil
+}
@@ -5,7 +5,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 	
 	cfg "github.com/zensqlmonitor/influxdb-zabbix/config"
 	log "github.com/zensqlmonitor/influxdb-zabbix/log"
@@ -14,29 +19,59 @@ import (
 type Registry struct {
 	Table     string
 	Startdate string
+	Cursor    *Cursor    `json:",omitempty"`
+	Backfills []Backfill `json:",omitempty"`
 }
 
-type MapTable map[string]string
+// Cursor is the key of the last row read of a table,
+// in the (clock, ns, itemid) order of the queries.
+type Cursor struct {
+	Clock  int64
+	Ns     int64
+	Itemid int64
+}
+
+// Checkpoint is the position of a table: the time polling resumes from and,
+// when known, the cursor of the last row read. Without cursor, all rows
+// up to Startdate included have been read.
+type Checkpoint struct {
+	Startdate string
+	Cursor    *Cursor
+}
+
+// Backfill tracks the windows done of a backfill over [From, To[.
+type Backfill struct {
+	From time.Time
+	To   time.Time
+	Done []Range
+}
+
+// Range is a [From, To[ time range.
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+type MapTable map[string]Checkpoint
 
 //var mapTables = make(MapTable)
 
 var mu sync.Mutex
 
+// fileMu serializes the writes of the registry file
+var fileMu sync.Mutex
 
-func check(e error) {
-	if e != nil {
-		panic(e)
-	}
-}
-
+// Read loads the checkpoints of the registry file into mapTables.
+// A registry file not created yet, e.g. in dry-run mode, has no checkpoint.
 func Read(config *cfg.TOMLConfig, mapTables *MapTable) error {
 
-	if _, err := ioutil.ReadFile(config.Registry.FileName); err != nil {
-		Create(config) // create file if not exist
-	}
-
 	registryJson, err := ioutil.ReadFile(config.Registry.FileName)
-	check(err)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
 	// parse JSON
 	regEntries := make([]Registry, 0)
@@ -46,46 +81,103 @@ func Read(config *cfg.TOMLConfig, mapTables *MapTable) error {
 
 	for i := 0; i < len(regEntries); i++ {
 		tableName := regEntries[i].Table
-		startdate := regEntries[i].Startdate
-		SetValueByKey(mapTables, tableName, startdate)
+		checkpoint := Checkpoint{Startdate: regEntries[i].Startdate, Cursor: regEntries[i].Cursor}
+		SetValueByKey(mapTables, tableName, checkpoint)
 	}
 
 	return nil
 }
 
-func Create(config *cfg.TOMLConfig) error {
+// Create adds an entry for each table of startdates not yet
+// in the registry file, creating the file if not exist.
+// Start dates are absolute, symbolic ones being resolved by the caller.
+// Existing entries are left untouched.
+func Create(config *cfg.TOMLConfig, startdates map[string]string) error {
 
 	if len(config.Tables) == 0 {
-		err := errors.New("No tables in configuration")
-		check(err)
+		return errors.New("No tables in configuration")
 	}
 
-	regEntries := make([]Registry, len(config.Tables))
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	unlock, err := lockFile(config.Registry.FileName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	var idx int = 0
-	for _, table := range config.Tables {
-		var reg Registry
-		reg.Table = table.Name
-		reg.Startdate = table.Startdate
-		regEntries[idx] = reg
-		idx += 1
+	// read file if exist
+	regEntries := make([]Registry, 0)
+	registryJson, err := ioutil.ReadFile(config.Registry.FileName)
+	exists := err == nil
+	if exists {
+		if err := json.Unmarshal(registryJson, &regEntries); err != nil {
+			return err
+		}
+	}
+	// entries created by a backfill have no startdate yet
+	known := make(map[string]int, len(regEntries))
+	for i, entry := range regEntries {
+		if len(entry.Startdate) > 0 || entry.Cursor != nil {
+			known[entry.Table] = -1
+		} else {
+			known[entry.Table] = i
+		}
+	}
+
+	var added []string
+	for tableName := range startdates {
+		if i, ok := known[tableName]; !ok || i >= 0 {
+			added = append(added, tableName)
+		}
+	}
+	if exists && len(added) == 0 {
+		return nil
+	}
+	sort.Strings(added)
+	for _, tableName := range added {
+		startdate := startdates[tableName]
+		if _, err := time.Parse(cfg.StartdateLayout, startdate); err != nil {
+			return fmt.Errorf("Startdate of table %s is not absolute. %v", tableName, err)
+		}
+		if i, ok := known[tableName]; ok {
+			regEntries[i].Startdate = startdate
+			continue
+		}
+		regEntries = append(regEntries, Registry{Table: tableName, Startdate: startdate})
 	}
 
 	// write JSON file
-	registryOutJson, _ := json.MarshalIndent(regEntries, "", "    ")
-	ioutil.WriteFile(config.Registry.FileName, registryOutJson, 0777)
-	log.Trace(fmt.Sprintf(
-		"------ New registry file created to %s",
-		config.Registry.FileName))
+	if err := write(config.Registry.FileName, regEntries); err != nil {
+		return err
+	}
+	if !exists {
+		log.Trace("------ New registry file created to %s",
+			config.Registry.FileName)
+	} else {
+		log.Trace("------ Tables %s added to registry file %s",
+			strings.Join(added, ", "),
+			config.Registry.FileName)
+	}
 
 	return nil
 }
 
-func Save(config cfg.TOMLConfig, tableName string, lastClock string) error {
+func Save(config cfg.TOMLConfig, tableName string, checkpoint Checkpoint) error {
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	unlock, err := lockFile(config.Registry.FileName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
 	// read  file
 	registryJson, err := ioutil.ReadFile(config.Registry.FileName)
-	check(err)
+	if err != nil {
+		return err
+	}
 
 	// parse JSON
 	regEntries := make([]Registry, 0)
@@ -95,33 +187,219 @@ func Save(config cfg.TOMLConfig, tableName string, lastClock string) error {
 	var found bool = false
 	for i := 0; i < len(regEntries); i++ {
 		if regEntries[i].Table == tableName {
-			regEntries[i].Startdate = lastClock
+			regEntries[i].Startdate = checkpoint.Startdate
+			regEntries[i].Cursor = checkpoint.Cursor
 			found = true
 		}
 	}
 	// if not found, create it
 	if found == false {
-		regEntries = append(regEntries, Registry{tableName, lastClock})
+		regEntries = append(regEntries, Registry{
+			Table:     tableName,
+			Startdate: checkpoint.Startdate,
+			Cursor:    checkpoint.Cursor})
 	}
 
 	// write JSON file
-	registryOutJson, _ := json.MarshalIndent(regEntries, "", "    ")
-	ioutil.WriteFile(config.Registry.FileName, registryOutJson, 0777)
+	return write(config.Registry.FileName, regEntries)
+}
+
+// Flush writes every entry of mapTables to the registry file,
+// keeping the entries of tables not in mapTables.
+func Flush(config cfg.TOMLConfig, mapTables MapTable) error {
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	unlock, err := lockFile(config.Registry.FileName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	mu.Lock()
+	defer mu.Unlock()
+
+	// read  file
+	regEntries := make([]Registry, 0)
+	if registryJson, err := ioutil.ReadFile(config.Registry.FileName); err == nil {
+		if err := json.Unmarshal(registryJson, &regEntries); err != nil {
+			return err
+		}
+	}
+
+	for tableName, checkpoint := range mapTables {
+		var found bool = false
+		for i := 0; i < len(regEntries); i++ {
+			if regEntries[i].Table == tableName {
+				regEntries[i].Startdate = checkpoint.Startdate
+				regEntries[i].Cursor = checkpoint.Cursor
+				found = true
+			}
+		}
+		if found == false {
+			regEntries = append(regEntries, Registry{
+				Table:     tableName,
+				Startdate: checkpoint.Startdate,
+				Cursor:    checkpoint.Cursor})
+		}
+	}
+
+	return write(config.Registry.FileName, regEntries)
+}
 
+// GetBackfill returns the windows done of the backfill of a table over [from, to[.
+func GetBackfill(config cfg.TOMLConfig, tableName string, from time.Time, to time.Time) ([]Range, error) {
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	registryJson, err := ioutil.ReadFile(config.Registry.FileName)
+	if os.IsNotExist(err) {
+		return nil, nil // not created in dry-run mode
+	}
+	if err != nil {
+		return nil, err
+	}
+	regEntries := make([]Registry, 0)
+	if err := json.Unmarshal(registryJson, &regEntries); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range regEntries {
+		if entry.Table != tableName {
+			continue
+		}
+		for _, backfill := range entry.Backfills {
+			if backfill.From.Equal(from) && backfill.To.Equal(to) {
+				return backfill.Done, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// SaveBackfill records the window [wfrom, wto[ of the backfill of a table over [from, to[ as done.
+func SaveBackfill(config cfg.TOMLConfig, tableName string, from time.Time, to time.Time,
+	wfrom time.Time, wto time.Time) error {
+
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	unlock, err := lockFile(config.Registry.FileName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// created here when a backfill runs before the daemon
+	regEntries := make([]Registry, 0)
+	registryJson, err := ioutil.ReadFile(config.Registry.FileName)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(registryJson, &regEntries); err != nil {
+			return err
+		}
+	}
+
+	var entry *Registry
+	for i := 0; i < len(regEntries); i++ {
+		if regEntries[i].Table == tableName {
+			entry = &regEntries[i]
+		}
+	}
+	if entry == nil {
+		regEntries = append(regEntries, Registry{Table: tableName})
+		entry = &regEntries[len(regEntries)-1]
+	}
+
+	var backfill *Backfill
+	for i := 0; i < len(entry.Backfills); i++ {
+		if entry.Backfills[i].From.Equal(from) && entry.Backfills[i].To.Equal(to) {
+			backfill = &entry.Backfills[i]
+		}
+	}
+	if backfill == nil {
+		entry.Backfills = append(entry.Backfills, Backfill{From: from, To: to})
+		backfill = &entry.Backfills[len(entry.Backfills)-1]
+	}
+	backfill.Done = mergeRanges(append(backfill.Done, Range{From: wfrom, To: wto}))
+
+	return write(config.Registry.FileName, regEntries)
+}
+
+// Covered reports whether [from, to[ is within one of the ranges.
+func Covered(ranges []Range, from time.Time, to time.Time) bool {
+	for _, r := range ranges {
+		if !from.Before(r.From) && !to.After(r.To) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeRanges sorts ranges and joins the adjacent or overlapping ones.
+func mergeRanges(ranges []Range) []Range {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].From.Before(ranges[j].From)
+	})
+	merged := make([]Range, 0, len(ranges))
+	for _, r := range ranges {
+		last := len(merged) - 1
+		if last >= 0 && !r.From.After(merged[last].To) {
+			if r.To.After(merged[last].To) {
+				merged[last].To = r.To
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// write replaces the registry file through a temporary file,
+// so that it is never left half written.
+func write(fileName string, regEntries []Registry) error {
+	registryOutJson, err := json.MarshalIndent(regEntries, "", "    ")
+	if err != nil {
+		return err
+	}
+	// unique name in the same directory, another process may be writing too
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(registryOutJson); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), fileName); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
 	return nil
 }
 
-func SetValueByKey(mt *MapTable, key string, value string) {
+func SetValueByKey(mt *MapTable, key string, value Checkpoint) {
 	mu.Lock()
 	defer mu.Unlock()
 	(*mt)[key] = value
 }
 
-func GetValueFromKey(mt MapTable, key string) string {
+func GetValueFromKey(mt MapTable, key string) Checkpoint {
 	if len(mt) > 0 {
 		mu.Lock()
 		defer mu.Unlock()
 		return mt[key]
 	}
-	return ""
+	return Checkpoint{}
 }
\ No newline at end of file
@@ -0,0 +1,108 @@
+package registry
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	cfg "github.com/zensqlmonitor/influxdb-zabbix/config"
+)
+
+// A backfill run before the daemon adds its ranges only,
+// the daemon then sets the startdate and keeps the ranges.
+func TestBackfillBeforeCreate(t *testing.T) {
+
+	var config cfg.TOMLConfig
+	config.Registry.FileName = filepath.Join(t.TempDir(), "registry.json")
+	config.Tables = map[string]*cfg.Table{"history": {Name: "history", Active: true}}
+
+	from := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+	if err := SaveBackfill(config, "history", from, to, from, from.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := Create(&config, map[string]string{"history": "2017-02-01T00:00:00"}); err != nil {
+		t.Fatal(err)
+	}
+
+	mapTables := make(MapTable)
+	if err := Read(&config, &mapTables); err != nil {
+		t.Fatal(err)
+	}
+	if got := GetValueFromKey(mapTables, "history").Startdate; got != "2017-02-01T00:00:00" {
+		t.Errorf("startdate %q", got)
+	}
+	done, err := GetBackfill(config, "history", from, to)
+	if err != nil || len(done) != 1 {
+		t.Errorf("backfill ranges %v (%v)", done, err)
+	}
+}
+
+// Concurrent writes of cursors and backfill ranges are all kept.
+func TestConcurrentWrites(t *testing.T) {
+
+	var config cfg.TOMLConfig
+	config.Registry.FileName = filepath.Join(t.TempDir(), "registry.json")
+	config.Tables = map[string]*cfg.Table{"history": {Name: "history", Active: true}}
+	if err := Create(&config, map[string]string{"history": "2017-01-01T00:00:00"}); err != nil {
+		t.Fatal(err)
+	}
+
+	from := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			wfrom := from.Add(time.Duration(2*i) * time.Hour)
+			if err := SaveBackfill(config, "history", from, from.AddDate(0, 0, 2), wfrom, wfrom.Add(time.Hour)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			cursor := Cursor{Clock: 1483228800 + int64(i)}
+			if err := Save(config, "history", Checkpoint{Startdate: "2017-01-01T00:00:00", Cursor: &cursor}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	done, err := GetBackfill(config, "history", from, from.AddDate(0, 0, 2))
+	if err != nil || len(done) != 20 {
+		t.Errorf("%d backfill ranges, want 20 (%v)", len(done), err)
+	}
+	files, _ := ioutil.ReadDir(filepath.Dir(config.Registry.FileName))
+	for _, f := range files {
+		if filepath.Ext(f.Name()) == ".tmp" {
+			t.Errorf("temporary file %s left", f.Name())
+		}
+	}
+}
+
+// A registry file that cannot be read is an error, not a panic.
+func TestReadError(t *testing.T) {
+
+	var config cfg.TOMLConfig
+	config.Registry.FileName = t.TempDir() // a directory
+
+	mapTables := make(MapTable)
+	if err := Read(&config, &mapTables); err == nil {
+		t.Error("registry read from a directory, want an error")
+	}
+}
+
+// A cursor saved while the registry file cannot be read is an error, not a panic.
+func TestSaveError(t *testing.T) {
+
+	var config cfg.TOMLConfig
+	config.Registry.FileName = filepath.Join(t.TempDir(), "registry.json")
+
+	cursor := Cursor{Clock: 1483228800}
+	if err := Save(config, "history", Checkpoint{Startdate: "2017-01-01T00:00:00", Cursor: &cursor}); err == nil {
+		t.Error("cursor saved without registry file, want an error")
+	}
+}
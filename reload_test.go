@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	toml "github.com/BurntSushi/toml"
+	cfg "github.com/zensqlmonitor/influxdb-zabbix/config"
+)
+
+// Adding a table on reload shifts the stagger of the tables sorted after it,
+// which must not restart them.
+func TestReloadStaggerSpec(t *testing.T) {
+
+	newConfig := func(tables ...string) cfg.TOMLConfig {
+		data := "[polling]\nstagger=5\n[zabbix.postgres]\naddress=\"host=localhost\"\n"
+		for _, name := range tables {
+			data += "[tables." + name + "]\nname=\"" + name + "\"\nactive=true\ninterval=15\nhoursperbatch=1\n"
+		}
+		var c cfg.TOMLConfig
+		if _, err := toml.Decode(data, &c); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	before, err := newWorkers(newConfig("history", "trends"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := newWorkers(newConfig("history", "history_uint", "trends"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after["tables.trends"].(*Param).stagger == before["tables.trends"].(*Param).stagger {
+		t.Fatal("stagger of trends not shifted, the test does not cover the case")
+	}
+	for _, name := range []string{"tables.history", "tables.trends"} {
+		if !reflect.DeepEqual(before[name].spec(), after[name].spec()) {
+			t.Errorf("%s restarted by the reload", name)
+		}
+	}
+}
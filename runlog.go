@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	helpers "github.com/zensqlmonitor/influxdb-zabbix/helpers"
+	log "github.com/zensqlmonitor/influxdb-zabbix/log"
+)
+
+// runLog logs the phases of a window run as they happen,
+// with the table, the window and the ID of the run.
+// A nil runLog logs nothing.
+type runLog struct {
+	table string
+	id    string
+	level int // level override of the table, or log.NoLevel
+	base  log.Fields
+}
+
+// newRunLog returns the log of a run of a table, or a collector,
+// its window starting at start, zero for collectors.
+func newRunLog(table string, start time.Time, level string) *runLog {
+	r := &runLog{
+		table: table,
+		id:    newRunID(),
+		level: logLevel(level),
+		base:  log.Fields{"table": table}}
+	r.base["run"] = r.id
+	if !start.IsZero() {
+		r.base["window"] = start
+	}
+	return r
+}
+
+// newRunID returns 8 random hex digits.
+func newRunID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%08x", uint32(time.Now().UnixNano()))
+	}
+	return hex.EncodeToString(b)
+}
+
+// logLevel returns the level of a level name, log.NoLevel when not set.
+func logLevel(name string) int {
+	if level, ok := log.LogLevels[name]; ok {
+		return level
+	}
+	return log.NoLevel
+}
+
+// entry returns the log entry of a phase, with the fields of the run.
+func (r *runLog) entry(phase string, fields log.Fields) log.Entry {
+	all := make(log.Fields, len(r.base)+len(fields)+1)
+	for k, v := range r.base {
+		all[k] = v
+	}
+	all["phase"] = phase
+	for k, v := range fields {
+		all[k] = v
+	}
+	return log.WithFields(all).WithLevel(r.level)
+}
+
+// text returns a message in the column-aligned text format:
+// label | table | run | message
+func (r *runLog) text(label string, format string, v ...interface{}) string {
+	return fmt.Sprintf("%s | %s | %s | %s",
+		label,
+		helpers.RightPad(r.table, " ", 12-len(r.table)),
+		r.id,
+		fmt.Sprintf(format, v...))
+}
+
+func (r *runLog) trace(phase string, fields log.Fields, label string, format string, v ...interface{}) {
+	if r == nil {
+		return
+	}
+	r.entry(phase, fields).Trace("%s", r.text(label, format, v...))
+}
+
+func (r *runLog) info(phase string, fields log.Fields, label string, format string, v ...interface{}) {
+	if r == nil {
+		return
+	}
+	r.entry(phase, fields).Info("%s", r.text(label, format, v...))
+}
+
+func (r *runLog) error(phase string, err error, format string, v ...interface{}) {
+	if r == nil {
+		log.WithFields(log.Fields{"phase": phase, "error": err}).Error(2, format, v...)
+		return
+	}
+	r.entry(phase, log.Fields{"error": err}).Error(2, "%s", r.text("*** Error  ", format, v...))
+}
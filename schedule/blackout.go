@@ -0,0 +1,74 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Blackout is a daily period, in local time, during which nothing is scheduled.
+// It is written as HH:MM-HH:MM and wraps over midnight when the end is before the start.
+type Blackout struct {
+	spec  string
+	start time.Duration // since midnight
+	end   time.Duration
+}
+
+// ParseBlackout parses a daily period.
+func ParseBlackout(spec string) (*Blackout, error) {
+
+	bounds := strings.Split(strings.TrimSpace(spec), "-")
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("blackout %q must be formatted as HH:MM-HH:MM", spec)
+	}
+	start, err := time.Parse("15:04", strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return nil, fmt.Errorf("blackout %q must be formatted as HH:MM-HH:MM", spec)
+	}
+	end, err := time.Parse("15:04", strings.TrimSpace(bounds[1]))
+	if err != nil {
+		return nil, fmt.Errorf("blackout %q must be formatted as HH:MM-HH:MM", spec)
+	}
+	if start.Equal(end) {
+		return nil, fmt.Errorf("blackout %q is empty", spec)
+	}
+
+	return &Blackout{
+		spec:  spec,
+		start: time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute,
+		end:   time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute}, nil
+}
+
+func (b *Blackout) String() string {
+	return b.spec
+}
+
+// Contains reports whether t is within the period.
+func (b *Blackout) Contains(t time.Time) bool {
+	since := sinceMidnight(t)
+	if b.start < b.end {
+		return since >= b.start && since < b.end
+	}
+	return since >= b.start || since < b.end
+}
+
+// After returns t when outside the period, the end of the period otherwise.
+func (b *Blackout) After(t time.Time) time.Time {
+	if !b.Contains(t) {
+		return t
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	end := midnight.Add(b.end)
+	if end.Before(t) {
+		// period started today, it ends the next day
+		end = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()).Add(b.end)
+	}
+	return end
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second +
+		time.Duration(t.Nanosecond())
+}
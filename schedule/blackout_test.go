@@ -0,0 +1,58 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBlackoutErrors(t *testing.T) {
+
+	for _, spec := range []string{"", "22:00", "22:00-", "22:00-06:00-07:00", "25:00-06:00", "22:60-06:00", "10:00-10:00"} {
+		if _, err := ParseBlackout(spec); err == nil {
+			t.Errorf("%q: parsed, want an error", spec)
+		}
+	}
+}
+
+func TestBlackout(t *testing.T) {
+
+	tests := []struct {
+		spec     string
+		t        time.Time
+		contains bool
+		after    time.Time
+	}{
+		// within a day
+		{"01:00-05:30", date(2017, 3, 1, 0, 59), false, date(2017, 3, 1, 0, 59)},
+		{"01:00-05:30", date(2017, 3, 1, 1, 0), true, date(2017, 3, 1, 5, 30)},
+		{"01:00-05:30", date(2017, 3, 1, 5, 29), true, date(2017, 3, 1, 5, 30)},
+		{"01:00-05:30", date(2017, 3, 1, 5, 30), false, date(2017, 3, 1, 5, 30)},
+
+		// wraps past midnight
+		{"22:00-06:00", date(2017, 3, 1, 21, 59), false, date(2017, 3, 1, 21, 59)},
+		{"22:00-06:00", date(2017, 3, 1, 22, 0), true, date(2017, 3, 2, 6, 0)},
+		{"22:00-06:00", date(2017, 3, 1, 23, 59), true, date(2017, 3, 2, 6, 0)},
+		{"22:00-06:00", date(2017, 3, 2, 0, 0), true, date(2017, 3, 2, 6, 0)},
+		{"22:00-06:00", date(2017, 3, 2, 5, 59), true, date(2017, 3, 2, 6, 0)},
+		{"22:00-06:00", date(2017, 3, 2, 6, 0), false, date(2017, 3, 2, 6, 0)},
+		{"22:00-06:00", date(2017, 3, 2, 12, 0), false, date(2017, 3, 2, 12, 0)},
+
+		// wraps past the end of a month and a year
+		{"23:30-00:30", date(2017, 2, 28, 23, 45), true, date(2017, 3, 1, 0, 30)},
+		{"23:30-00:30", date(2017, 12, 31, 23, 30), true, date(2018, 1, 1, 0, 30)},
+	}
+
+	for _, tt := range tests {
+		b, err := ParseBlackout(tt.spec)
+		if err != nil {
+			t.Errorf("%q: %v", tt.spec, err)
+			continue
+		}
+		if got := b.Contains(tt.t); got != tt.contains {
+			t.Errorf("%q contains %v: %v, want %v", tt.spec, tt.t, got, tt.contains)
+		}
+		if got := b.After(tt.t); !got.Equal(tt.after) {
+			t.Errorf("%q after %v: %v, want %v", tt.spec, tt.t, got, tt.after)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Package schedule provides cron-like schedules and daily blackout periods.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron expression of five fields, in local time:
+//
+//	minute (0-59) hour (0-23) day-of-month (1-31) month (1-12) day-of-week (0-6, Sunday is 0 or 7)
+//
+// Each field is *, a value, a range a-b or a list of them separated by commas,
+// optionally followed by a step /n. The macros @hourly, @daily, @midnight,
+// @weekly and @monthly are also accepted.
+type Schedule struct {
+	spec   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// both days restricted: a day matches either of them, as in cron
+	domStar bool
+	dowStar bool
+}
+
+var macros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// Parse parses a cron expression.
+func Parse(spec string) (*Schedule, error) {
+
+	expr := strings.TrimSpace(spec)
+	if macro, ok := macros[expr]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q must have 5 fields, got %d", spec, len(fields))
+	}
+
+	s := &Schedule{spec: spec}
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("schedule %q: minute %s", spec, err)
+	}
+	if s.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("schedule %q: hour %s", spec, err)
+	}
+	if s.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("schedule %q: day of month %s", spec, err)
+	}
+	if s.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("schedule %q: month %s", spec, err)
+	}
+	if s.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("schedule %q: day of week %s", spec, err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 << 0
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+
+	if s.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("schedule %q never matches", spec)
+	}
+	return s, nil
+}
+
+// parseField returns the bit set of the values of a field.
+func parseField(field string, min int, max int) (uint64, error) {
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("has an invalid step in %q", part)
+			}
+			rng, step = part[:i], n
+		}
+
+		low, high := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("has an invalid range %q", part)
+			}
+			if high, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, fmt.Errorf("has an invalid range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, fmt.Errorf("has an invalid value %q", part)
+			}
+			low = n
+			if step == 1 {
+				high = n
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, fmt.Errorf("%q is out of [%d-%d]", part, min, max)
+		}
+
+		for v := low; v <= high; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+// Matches reports whether the minute of t is scheduled.
+func (s *Schedule) Matches(t time.Time) bool {
+	return has(s.minute, t.Minute()) &&
+		has(s.hour, t.Hour()) &&
+		has(s.month, int(t.Month())) &&
+		s.matchesDay(t)
+}
+
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dom := has(s.dom, t.Day())
+	dow := has(s.dow, int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first scheduled minute after t,
+// or the zero time if none within five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+
+	next := t.Truncate(time.Minute).Add(time.Minute)
+	limit := next.AddDate(5, 0, 0)
+
+	for next.Before(limit) {
+		switch {
+		case !has(s.month, int(next.Month())):
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+		case !s.matchesDay(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location())
+		case !has(s.hour, next.Hour()):
+			next = time.Date(next.Year(), next.Month(), next.Day(), next.Hour()+1, 0, 0, 0, next.Location())
+		case !has(s.minute, next.Minute()):
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
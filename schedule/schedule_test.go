@@ -0,0 +1,127 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+}
+
+func TestParseFields(t *testing.T) {
+
+	tests := []struct {
+		field    string
+		min, max int
+		values   []int
+	}{
+		{"*", 0, 5, []int{0, 1, 2, 3, 4, 5}},
+		{"3", 0, 59, []int{3}},
+		{"1-4", 0, 59, []int{1, 2, 3, 4}},
+		{"1,5,9", 0, 59, []int{1, 5, 9}},
+		{"*/15", 0, 59, []int{0, 15, 30, 45}},
+		{"10-20/5", 0, 59, []int{10, 15, 20}},
+		{"5/20", 0, 59, []int{5, 25, 45}},
+		{"1-3,10-30/10,45", 0, 59, []int{1, 2, 3, 10, 20, 30, 45}},
+		{"*/2", 1, 12, []int{1, 3, 5, 7, 9, 11}},
+	}
+
+	for _, tt := range tests {
+		bits, err := parseField(tt.field, tt.min, tt.max)
+		if err != nil {
+			t.Errorf("%q: %v", tt.field, err)
+			continue
+		}
+		var want uint64
+		for _, v := range tt.values {
+			want |= 1 << uint(v)
+		}
+		if bits != want {
+			t.Errorf("%q = %b, want %b", tt.field, bits, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"0 0 31 2 *",
+		"@yearly",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("%q: parsed, want an error", spec)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+
+	tests := []struct {
+		spec string
+		from time.Time
+		next time.Time
+	}{
+		// steps, ranges and lists
+		{"*/15 * * * *", date(2017, 3, 1, 10, 7), date(2017, 3, 1, 10, 15)},
+		{"*/15 * * * *", date(2017, 3, 1, 10, 45), date(2017, 3, 1, 11, 0)},
+		{"0 9-17 * * *", date(2017, 3, 1, 17, 30), date(2017, 3, 2, 9, 0)},
+		{"0 9-17 * * *", date(2017, 3, 1, 8, 59), date(2017, 3, 1, 9, 0)},
+		{"30 1,13 * * *", date(2017, 3, 1, 2, 0), date(2017, 3, 1, 13, 30)},
+		{"0 0 * * 1-5", date(2017, 3, 3, 12, 0), date(2017, 3, 6, 0, 0)}, // Friday to Monday
+
+		// strictly after t
+		{"0 * * * *", date(2017, 3, 1, 10, 0), date(2017, 3, 1, 11, 0)},
+		{"* * * * *", time.Date(2017, 3, 1, 10, 0, 30, 0, time.UTC), date(2017, 3, 1, 10, 1)},
+
+		// Sunday is 0 or 7
+		{"0 0 * * 7", date(2017, 3, 1, 0, 0), date(2017, 3, 5, 0, 0)},
+		{"@weekly", date(2017, 3, 1, 0, 0), date(2017, 3, 5, 0, 0)},
+
+		// both days restricted: either matches
+		{"0 0 13 * 5", date(2017, 1, 1, 0, 0), date(2017, 1, 6, 0, 0)},  // Friday 6th
+		{"0 0 13 * 5", date(2017, 1, 7, 0, 0), date(2017, 1, 13, 0, 0)}, // Friday 13th
+		{"0 0 10 * 1", date(2017, 1, 1, 0, 0), date(2017, 1, 2, 0, 0)},  // Monday 2nd
+		{"0 0 10 * 1", date(2017, 1, 3, 0, 0), date(2017, 1, 9, 0, 0)},  // Monday 9th
+		{"0 0 10 * 1", date(2017, 1, 9, 0, 0), date(2017, 1, 10, 0, 0)}, // Tuesday 10th
+		// one day restricted: both must match
+		{"0 0 13 * *", date(2017, 1, 1, 0, 0), date(2017, 1, 13, 0, 0)},
+		{"0 0 * * 5", date(2017, 1, 7, 0, 0), date(2017, 1, 13, 0, 0)},
+		{"0 0 */10 * 1", date(2017, 1, 1, 0, 0), date(2017, 5, 1, 0, 0)}, // */10 counts as *: Monday 1st
+
+		// month and year rollover
+		{"0 0 1 * *", date(2017, 1, 31, 23, 59), date(2017, 2, 1, 0, 0)},
+		{"0 0 31 * *", date(2017, 4, 1, 0, 0), date(2017, 5, 31, 0, 0)},
+		{"0 0 29 2 *", date(2017, 3, 1, 0, 0), date(2020, 2, 29, 0, 0)},
+		{"0 0 1 1 *", date(2017, 12, 31, 23, 59), date(2018, 1, 1, 0, 0)},
+		{"59 23 31 12 *", date(2017, 12, 31, 23, 59), date(2018, 12, 31, 23, 59)},
+		{"@monthly", date(2017, 12, 15, 0, 0), date(2018, 1, 1, 0, 0)},
+		{"0 0 * 2 *", date(2017, 3, 1, 0, 0), date(2018, 2, 1, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("%q: %v", tt.spec, err)
+			continue
+		}
+		if next := s.Next(tt.from); !next.Equal(tt.next) {
+			t.Errorf("%q after %v: %v, want %v", tt.spec, tt.from, next, tt.next)
+		}
+		if !s.Matches(tt.next) {
+			t.Errorf("%q does not match %v", tt.spec, tt.next)
+		}
+	}
+}
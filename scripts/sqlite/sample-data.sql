@@ -0,0 +1,26 @@
+-- A few rows to run influxdb-zabbix offline with the sqlite provider.
+--
+--   sqlite3 zabbix.db < zabbix-schema.sql
+--   sqlite3 zabbix.db < sample-data.sql
+
+INSERT INTO hosts (hostid, host, name) VALUES (10084, 'zabbix-server', 'Zabbix server');
+INSERT INTO hstgrp (groupid, name, internal) VALUES (4, 'Zabbix servers', 0);
+INSERT INTO hosts_groups (hostgroupid, hostid, groupid) VALUES (1, 10084, 4);
+
+INSERT INTO items (itemid, hostid, name, key_, value_type) VALUES
+	(23252, 10084, 'Processor load (1 min average per core)', 'system.cpu.load[percpu,avg1]', 0),
+	(23662, 10084, 'Free disk space on $1', 'vfs.fs.size[/,free]', 3);
+INSERT INTO applications (applicationid, hostid, name) VALUES (1, 10084, 'CPU'), (2, 10084, 'Filesystems');
+INSERT INTO items_applications (itemappid, applicationid, itemid) VALUES (1, 1, 23252), (2, 2, 23662);
+
+INSERT INTO history (itemid, clock, value, ns) VALUES
+	(23252, 1483228830, 0.15, 120000000),
+	(23252, 1483228860, 0.2, 0),
+	(23252, 1483228890, 0.05, 500000000);
+INSERT INTO history_uint (itemid, clock, value, ns) VALUES
+	(23662, 1483228830, 21474836480, 0),
+	(23662, 1483228890, 21474832384, 0);
+INSERT INTO trends (itemid, clock, num, value_min, value_avg, value_max) VALUES
+	(23252, 1483228800, 60, 0.05, 0.13, 0.2);
+INSERT INTO trends_uint (itemid, clock, num, value_min, value_avg, value_max) VALUES
+	(23662, 1483228800, 60, 21474832384, 21474834432, 21474836480);
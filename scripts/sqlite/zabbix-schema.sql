@@ -0,0 +1,89 @@
+-- Subset of the Zabbix schema read by influxdb-zabbix, for the sqlite provider.
+--
+--   sqlite3 zabbix.db < zabbix-schema.sql
+
+CREATE TABLE IF NOT EXISTS hosts (
+	hostid    bigint                  NOT NULL,
+	host      varchar(128) DEFAULT '' NOT NULL,
+	name      varchar(128) DEFAULT '' NOT NULL,
+	status    integer      DEFAULT 0  NOT NULL,
+	PRIMARY KEY (hostid)
+);
+
+CREATE TABLE IF NOT EXISTS hstgrp (
+	groupid   bigint                  NOT NULL,
+	name      varchar(255) DEFAULT '' NOT NULL,
+	internal  integer      DEFAULT 0  NOT NULL,
+	PRIMARY KEY (groupid)
+);
+
+CREATE TABLE IF NOT EXISTS hosts_groups (
+	hostgroupid bigint NOT NULL,
+	hostid      bigint NOT NULL,
+	groupid     bigint NOT NULL,
+	PRIMARY KEY (hostgroupid)
+);
+
+CREATE TABLE IF NOT EXISTS items (
+	itemid    bigint                  NOT NULL,
+	hostid    bigint                  NOT NULL,
+	name      varchar(255) DEFAULT '' NOT NULL,
+	key_      varchar(255) DEFAULT '' NOT NULL,
+	value_type integer     DEFAULT 0  NOT NULL,
+	status    integer      DEFAULT 0  NOT NULL,
+	PRIMARY KEY (itemid)
+);
+
+CREATE TABLE IF NOT EXISTS applications (
+	applicationid bigint                  NOT NULL,
+	hostid        bigint                  NOT NULL,
+	name          varchar(255) DEFAULT '' NOT NULL,
+	PRIMARY KEY (applicationid)
+);
+
+CREATE TABLE IF NOT EXISTS items_applications (
+	itemappid     bigint NOT NULL,
+	applicationid bigint NOT NULL,
+	itemid        bigint NOT NULL,
+	PRIMARY KEY (itemappid)
+);
+
+CREATE TABLE IF NOT EXISTS history (
+	itemid bigint                   NOT NULL,
+	clock  integer DEFAULT '0'      NOT NULL,
+	value  double(16,4) DEFAULT '0.0000' NOT NULL,
+	ns     integer DEFAULT '0'      NOT NULL
+);
+CREATE INDEX IF NOT EXISTS history_1 ON history (itemid, clock);
+CREATE INDEX IF NOT EXISTS idx_history_clock ON history (clock);
+
+CREATE TABLE IF NOT EXISTS history_uint (
+	itemid bigint              NOT NULL,
+	clock  integer DEFAULT '0' NOT NULL,
+	value  bigint  DEFAULT '0' NOT NULL,
+	ns     integer DEFAULT '0' NOT NULL
+);
+CREATE INDEX IF NOT EXISTS history_uint_1 ON history_uint (itemid, clock);
+CREATE INDEX IF NOT EXISTS idx_history_uint_clock ON history_uint (clock);
+
+CREATE TABLE IF NOT EXISTS trends (
+	itemid    bigint                         NOT NULL,
+	clock     integer      DEFAULT '0'       NOT NULL,
+	num       integer      DEFAULT '0'       NOT NULL,
+	value_min double(16,4) DEFAULT '0.0000'  NOT NULL,
+	value_avg double(16,4) DEFAULT '0.0000'  NOT NULL,
+	value_max double(16,4) DEFAULT '0.0000'  NOT NULL,
+	PRIMARY KEY (itemid, clock)
+);
+CREATE INDEX IF NOT EXISTS idx_trends_clock ON trends (clock);
+
+CREATE TABLE IF NOT EXISTS trends_uint (
+	itemid    bigint              NOT NULL,
+	clock     integer DEFAULT '0' NOT NULL,
+	num       integer DEFAULT '0' NOT NULL,
+	value_min bigint  DEFAULT '0' NOT NULL,
+	value_avg bigint  DEFAULT '0' NOT NULL,
+	value_max bigint  DEFAULT '0' NOT NULL,
+	PRIMARY KEY (itemid, clock)
+);
+CREATE INDEX IF NOT EXISTS idx_trends_uint_clock ON trends_uint (clock);
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cfg "github.com/zensqlmonitor/influxdb-zabbix/config"
+	log "github.com/zensqlmonitor/influxdb-zabbix/log"
+	influx "github.com/zensqlmonitor/influxdb-zabbix/output/influxdb"
+)
+
+// statsTimeout bounds the write of the stats.
+const statsTimeout time.Duration = 10 * time.Second
+
+// tableStats are the stats of a table or collector since the last write.
+type tableStats struct {
+	extracts       int
+	rows           int64
+	extractTime    time.Duration
+	maxExtractTime time.Duration
+	batches        int
+	points         int64
+	loadTime       time.Duration
+	maxLoadTime    time.Duration
+	failedBatches  int
+	checkpoint     time.Time
+}
+
+// statsCollector gathers the stats written to InfluxDB on an interval.
+type statsCollector struct {
+	mu     sync.Mutex
+	tables map[string]*tableStats
+}
+
+var selfStats = &statsCollector{tables: make(map[string]*tableStats)}
+
+// table returns the stats of a table, the lock being held.
+func (s *statsCollector) table(name string) *tableStats {
+	t, ok := s.tables[name]
+	if !ok {
+		t = &tableStats{}
+		s.tables[name] = t
+	}
+	return t
+}
+
+func (s *statsCollector) extract(name string, rows int, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.table(name)
+	t.extracts++
+	t.rows += int64(rows)
+	t.extractTime += duration
+	if duration > t.maxExtractTime {
+		t.maxExtractTime = duration
+	}
+}
+
+func (s *statsCollector) load(name string, points int, duration time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.table(name)
+	t.batches++
+	t.loadTime += duration
+	if duration > t.maxLoadTime {
+		t.maxLoadTime = duration
+	}
+	if err != nil {
+		t.failedBatches++
+	} else {
+		t.points += int64(points)
+	}
+}
+
+// merge adds the counts of o to t.
+func (t *tableStats) merge(o *tableStats) {
+	t.extracts += o.extracts
+	t.rows += o.rows
+	t.extractTime += o.extractTime
+	if o.maxExtractTime > t.maxExtractTime {
+		t.maxExtractTime = o.maxExtractTime
+	}
+	t.batches += o.batches
+	t.points += o.points
+	t.loadTime += o.loadTime
+	if o.maxLoadTime > t.maxLoadTime {
+		t.maxLoadTime = o.maxLoadTime
+	}
+	t.failedBatches += o.failedBatches
+}
+
+func (s *statsCollector) checkpoint(name string, checkpoint time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.table(name).checkpoint = checkpoint
+}
+
+// lines returns the stats as line protocol, one point per table,
+// and resets them, checkpoints apart. The stats taken are returned
+// to be restored if the lines cannot be written.
+func (s *statsCollector) lines(measurement string, now time.Time) ([]string, map[string]*tableStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.tables))
+	for name := range s.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, 0, len(names))
+	taken := make(map[string]*tableStats, len(names))
+	for _, name := range names {
+		t := s.tables[name]
+		fields := []string{
+			fmt.Sprintf("extracts=%di", t.extracts),
+			fmt.Sprintf("rows=%di", t.rows),
+			fmt.Sprintf("extract_seconds=%g", t.extractTime.Seconds()),
+			fmt.Sprintf("extract_max_seconds=%g", t.maxExtractTime.Seconds()),
+			fmt.Sprintf("batches=%di", t.batches),
+			fmt.Sprintf("points=%di", t.points),
+			fmt.Sprintf("load_seconds=%g", t.loadTime.Seconds()),
+			fmt.Sprintf("load_max_seconds=%g", t.maxLoadTime.Seconds()),
+			fmt.Sprintf("batches_failed=%di", t.failedBatches)}
+		if !t.checkpoint.IsZero() {
+			fields = append(fields,
+				fmt.Sprintf("lag_seconds=%g", now.Sub(t.checkpoint).Truncate(time.Second).Seconds()))
+		}
+		lines = append(lines, fmt.Sprintf("%s,table=%s %s %d",
+			measurementEscaper.Replace(measurement),
+			tagEscaper.Replace(name),
+			strings.Join(fields, ","),
+			now.Unix()))
+
+		s.tables[name] = &tableStats{checkpoint: t.checkpoint}
+		taken[name] = t
+	}
+	return lines, taken
+}
+
+// restore adds back the stats taken by lines, once their write failed.
+func (s *statsCollector) restore(taken map[string]*tableStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, t := range taken {
+		s.table(name).merge(t)
+	}
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+// initStats writes the stats on an interval, if configured.
+func initStats(config cfg.TOMLConfig) {
+
+	if config.Stats.Interval == 0 {
+		return
+	}
+	var interval time.Duration = time.Duration(config.Stats.Interval) * time.Second
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := flushStats(currentConfig()); err != nil {
+				log.Error(1, "Error while writing stats. %s", err)
+			}
+		}
+	}()
+	log.Info("--- Writing stats to %s.%s every %v",
+		config.Stats.Database,
+		config.Stats.Measurement,
+		interval)
+}
+
+// flushStats writes the stats since the last write to InfluxDB, or to the output file.
+// The stats are kept for the next write on failure.
+func flushStats(config cfg.TOMLConfig) error {
+
+	lines, taken := selfStats.lines(config.Stats.Measurement, time.Now())
+	if len(lines) == 0 {
+		return nil
+	}
+	if err := writeStats(config, lines); err != nil {
+		selfStats.restore(taken)
+		return err
+	}
+	return nil
+}
+
+func writeStats(config cfg.TOMLConfig, lines []string) error {
+
+	if fileOutput != nil {
+		return fileOutput.Write("stats", 1, 1, lines)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statsTimeout)
+	defer cancel()
+	loa := influx.NewLoader(
+		fmt.Sprintf(
+			"%s/write?db=%s&precision=s",
+			config.InfluxDB.Url,
+			config.Stats.Database),
+		config.InfluxDB.Username,
+		config.InfluxDB.Password,
+		strings.Join(lines, "\n"))
+
+	return loa.Load(ctx)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cfg "github.com/zensqlmonitor/influxdb-zabbix/config"
+)
+
+// Stats not written are kept for the next write.
+func TestFlushStatsFailure(t *testing.T) {
+
+	var status = http.StatusInternalServerError
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	var config cfg.TOMLConfig
+	config.InfluxDB.Url = server.URL
+	config.Stats.Database = "zabbix"
+	config.Stats.Measurement = cfg.DefaultStatsMeasurement
+
+	selfStats = &statsCollector{tables: make(map[string]*tableStats)}
+	selfStats.extract("history", 10, 2*time.Second)
+	selfStats.load("history", 10, time.Second, nil)
+	if err := flushStats(config); err == nil {
+		t.Fatal("write failed, want an error")
+	}
+
+	selfStats.extract("history", 5, 3*time.Second)
+	status = http.StatusNoContent
+	if err := flushStats(config); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"extracts=2i", "rows=15i", "extract_seconds=5,", "extract_max_seconds=3,", "batches=1i", "points=10i"} {
+		if !strings.Contains(body, field) {
+			t.Errorf("%s not in %s", field, body)
+		}
+	}
+
+	// written once
+	if lines, _ := selfStats.lines(config.Stats.Measurement, time.Now()); !strings.Contains(lines[0], "rows=0i") {
+		t.Errorf("stats not reset after the write: %s", lines[0])
+	}
+}
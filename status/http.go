@@ -0,0 +1,92 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	metrics "github.com/zensqlmonitor/influxdb-zabbix/metrics"
+)
+
+// readyTimeout bounds the checks of /ready.
+const readyTimeout time.Duration = 5 * time.Second
+
+var startTime = time.Now()
+
+// Start listens on address and serves in background:
+//   - /health: liveness, 503 when a worker failed or a table lags beyond its threshold at level Error
+//   - /ready: 503 when ready returns an error, e.g. a database or InfluxDB not reachable
+//   - /status: status of the workers
+//   - /metrics: metrics in the Prometheus text format
+func Start(address string, ready func(ctx context.Context) error) error {
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", health)
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+		if err := ready(ctx); err != nil {
+			reply(w, http.StatusServiceUnavailable, map[string]string{
+				"status": "not ready",
+				"error":  err.Error()})
+			return
+		}
+		reply(w, http.StatusOK, map[string]string{"status": "ready"})
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		reply(w, http.StatusOK, map[string]interface{}{
+			"started":        startTime,
+			"uptime_seconds": time.Since(startTime).Seconds(),
+			"workers":        Workers()})
+	})
+	mux.Handle("/metrics", metrics.Handler())
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	return nil
+}
+
+func health(w http.ResponseWriter, r *http.Request) {
+	var failed, lagging []string
+	var lagFailed bool
+	for _, st := range Workers() {
+		if st.State == Failed {
+			failed = append(failed, st.Kind+"."+st.Name)
+		}
+		if st.Lagging {
+			lagging = append(lagging, st.Kind+"."+st.Name)
+			lagFailed = lagFailed || st.LagLevel == "Error"
+		}
+	}
+
+	body := map[string]interface{}{"status": "ok"}
+	code := http.StatusOK
+	if len(lagging) > 0 {
+		body["status"] = "lagging"
+		body["lagging"] = lagging
+		if lagFailed {
+			code = http.StatusServiceUnavailable
+		}
+	}
+	if len(failed) > 0 {
+		body["status"] = "failed"
+		body["failed"] = failed
+		code = http.StatusServiceUnavailable
+	}
+	reply(w, code, body)
+}
+
+func reply(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(body)
+}
@@ -0,0 +1,186 @@
+// Package status tracks the state of the table and collector workers
+// and serves it over HTTP.
+package status
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// States of a worker.
+const (
+	Starting   string = "starting"
+	Waiting    string = "waiting"
+	Extracting string = "extracting"
+	Loading    string = "loading"
+	Stopped    string = "stopped"
+	Failed     string = "failed"
+)
+
+// Worker is the status of a table or collector worker.
+type Worker struct {
+	mu          sync.Mutex
+	name        string
+	kind        string
+	state       string
+	checkpoint  time.Time
+	nextRun     time.Time
+	lastSuccess time.Time
+	lastError   string
+	lastErrorAt time.Time
+	rows        int64
+	bytes       int64
+	maxLag      time.Duration
+	lagLevel    string
+}
+
+// WorkerStatus is a snapshot of a worker status, as served by /status.
+// Times not known yet are left out.
+type WorkerStatus struct {
+	Name        string     `json:"name"`
+	Kind        string     `json:"kind"`
+	State       string     `json:"state"`
+	Checkpoint  *time.Time `json:"checkpoint,omitempty"`
+	LagSeconds  *float64   `json:"lag_seconds,omitempty"`
+	NextRun     *time.Time `json:"next_run,omitempty"`
+	LastSuccess *time.Time `json:"last_success,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	Rows        int64      `json:"rows"`
+	Bytes       int64      `json:"bytes"`
+
+	// set for tables with a lag threshold
+	MaxLagSeconds *float64 `json:"max_lag_seconds,omitempty"`
+	LagLevel      string   `json:"max_lag_level,omitempty"`
+	Lagging       bool     `json:"lagging,omitempty"`
+}
+
+var (
+	mu      sync.Mutex
+	workers = make(map[string]*Worker)
+)
+
+// Register returns the status of a worker, created on first call.
+// A worker restarted on reload keeps its counters.
+func Register(kind string, name string) *Worker {
+	mu.Lock()
+	defer mu.Unlock()
+
+	key := kind + "." + name
+	w, ok := workers[key]
+	if !ok {
+		w = &Worker{name: name, kind: kind}
+		workers[key] = w
+	}
+	w.SetState(Starting)
+	return w
+}
+
+// SetState sets the current state of the worker.
+func (w *Worker) SetState(state string) {
+	w.mu.Lock()
+	w.state = state
+	w.mu.Unlock()
+}
+
+// SetNextRun sets the time of the next poll.
+func (w *Worker) SetNextRun(next time.Time) {
+	w.mu.Lock()
+	w.nextRun = next
+	w.mu.Unlock()
+}
+
+// SetMaxLag sets the lag threshold of the checkpoint, none when zero,
+// and the level, Warn or Error, reported once it is exceeded.
+func (w *Worker) SetMaxLag(maxLag time.Duration, level string) {
+	w.mu.Lock()
+	w.maxLag = maxLag
+	w.lagLevel = level
+	w.mu.Unlock()
+}
+
+// SetCheckpoint sets the checkpoint known before the first poll,
+// so that the lag is reported even if the first poll never succeeds.
+func (w *Worker) SetCheckpoint(checkpoint time.Time) {
+	w.mu.Lock()
+	w.checkpoint = checkpoint
+	w.mu.Unlock()
+}
+
+// Success records a poll done: its checkpoint, zero for collectors, and what was sent.
+func (w *Worker) Success(checkpoint time.Time, rows int, bytes int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.checkpoint = checkpoint
+	w.lastSuccess = time.Now()
+	w.rows += int64(rows)
+	w.bytes += int64(bytes)
+}
+
+// Failure records the error of a poll.
+func (w *Worker) Failure(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state = Failed
+	w.lastError = err.Error()
+	w.lastErrorAt = time.Now()
+}
+
+// Status returns a snapshot of the worker status.
+func (w *Worker) Status() WorkerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	st := WorkerStatus{
+		Name:        w.name,
+		Kind:        w.kind,
+		State:       w.state,
+		Checkpoint:  timePtr(w.checkpoint),
+		NextRun:     timePtr(w.nextRun),
+		LastSuccess: timePtr(w.lastSuccess),
+		LastError:   w.lastError,
+		LastErrorAt: timePtr(w.lastErrorAt),
+		Rows:        w.rows,
+		Bytes:       w.bytes}
+	if !w.checkpoint.IsZero() {
+		lag := time.Since(w.checkpoint).Seconds()
+		st.LagSeconds = &lag
+	}
+	if w.maxLag > 0 {
+		maxLag := w.maxLag.Seconds()
+		st.MaxLagSeconds = &maxLag
+		st.LagLevel = w.lagLevel
+		st.Lagging = w.state != Stopped && st.LagSeconds != nil && *st.LagSeconds > maxLag
+	}
+	return st
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Workers returns a snapshot of all worker statuses, by kind and name.
+func Workers() []WorkerStatus {
+	mu.Lock()
+	list := make([]*Worker, 0, len(workers))
+	for _, w := range workers {
+		list = append(list, w)
+	}
+	mu.Unlock()
+
+	statuses := make([]WorkerStatus, 0, len(list))
+	for _, w := range list {
+		statuses = append(statuses, w.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Kind != statuses[j].Kind {
+			return statuses[i].Kind < statuses[j].Kind
+		}
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}